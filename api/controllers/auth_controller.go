@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"NemWebGoApi/api/models"
+	"NemWebGoApi/internal/auth"
+	"NemWebGoApi/internal/logging"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// adminKeyID identifies the bootstrap ADMIN_API_KEY in audit logs, database keys start at 1
+const adminKeyID = 0
+
+type createAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type createAPIKeyResponse struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+// authenticate resolves the API key in the Authorization header to a principal on the request context,
+// requests without a key continue anonymously and are rejected by requireScope when auth is enabled
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := auth.KeyFromRequest(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, err := s.lookupKey(r, key)
+		if err != nil {
+			if !errors.Is(err, models.ErrAPIKeyNotFound) {
+				logging.FromContext(r.Context()).Warnln("Error Looking Up API Key:", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			logging.FromContext(r.Context()).WithFields(log.Fields{
+				"audit":  true,
+				"client": r.RemoteAddr,
+				"method": r.Method,
+				"path":   r.URL.Path,
+			}).Warnln("Rejected invalid API key")
+			s.respondUnauthorized(w, r, "invalid api key")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+func (s *Server) lookupKey(r *http.Request, key string) (*auth.Principal, error) {
+	if admin := s.Config().AdminAPIKey(); admin != "" && auth.KeysEqual(key, admin) {
+		return &auth.Principal{KeyID: adminKeyID, Name: "admin", Scopes: []string{auth.ScopeAdmin}}, nil
+	}
+
+	apiKey, err := models.FindAPIKey(r.Context(), s.SQLDb, key)
+	if err != nil {
+		return nil, err
+	}
+	return &auth.Principal{KeyID: apiKey.ID, Name: apiKey.Name, Scopes: apiKey.Scopes}, nil
+}
+
+// requireScope wraps a handler so it is only served to principals with scope,
+// every request is allowed through when auth is disabled
+func (s *Server) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.Config().AuthEnabled() {
+			next(w, r)
+			return
+		}
+
+		principal := auth.FromContext(r.Context())
+		if principal == nil {
+			s.respondUnauthorized(w, r, "api key required")
+			return
+		}
+		if !principal.HasScope(scope) {
+			s.respond(w, r, map[string]string{"error": "api key lacks scope " + scope}, http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireAdmin wraps a handler so it is only served to admin principals,
+// unlike requireScope this applies even when auth is disabled
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return s.requireAuthenticated(auth.ScopeAdmin, next)
+}
+
+// requireAuthenticated wraps a handler so it is only served to principals with scope,
+// unlike requireScope this applies even when auth is disabled, used for admin and write endpoints
+func (s *Server) requireAuthenticated(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := auth.FromContext(r.Context())
+		if principal == nil {
+			s.respondUnauthorized(w, r, "api key required")
+			return
+		}
+		if !principal.HasScope(scope) {
+			s.respond(w, r, map[string]string{"error": "api key lacks scope " + scope}, http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) respondUnauthorized(w http.ResponseWriter, r *http.Request, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="nemweb"`)
+	s.respond(w, r, map[string]string{"error": msg}, http.StatusUnauthorized)
+}
+
+func (s *Server) GetAllAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := models.ReadAllAPIKeys(r.Context(), s.SQLDb)
+	if err != nil {
+		logging.FromContext(r.Context()).Debugln("Error Reading API Keys:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.respond(w, r, keys, http.StatusOK)
+}
+
+func (s *Server) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+	if err := s.decode(w, r, &req); err != nil {
+		s.respond(w, r, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" || len(req.Scopes) == 0 {
+		s.respond(w, r, map[string]string{"error": "name and scopes are required"}, http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			s.respond(w, r, map[string]string{"error": "invalid scope " + scope}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	key, plaintext, err := models.CreateAPIKey(r.Context(), s.SQLDb, req.Name, req.Scopes)
+	if err != nil {
+		logging.FromContext(r.Context()).Debugln("Error Creating API Key:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	logging.FromContext(r.Context()).WithFields(log.Fields{
+		"audit":      true,
+		"new_key_id": key.ID,
+		"new_key":    key.Name,
+		"scopes":     key.Scopes,
+		"issued_by":  auth.FromContext(r.Context()).String(),
+	}).Infoln("Issued API key")
+	s.respond(w, r, createAPIKeyResponse{APIKey: *key, Key: plaintext}, http.StatusCreated)
+}
+
+func (s *Server) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		s.respond(w, r, map[string]string{"error": "invalid key id"}, http.StatusBadRequest)
+		return
+	}
+
+	err = models.RevokeAPIKey(r.Context(), s.SQLDb, id)
+	if errors.Is(err, models.ErrAPIKeyNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Debugln("Error Revoking API Key:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	logging.FromContext(r.Context()).WithFields(log.Fields{
+		"audit":      true,
+		"revoked_id": id,
+		"revoked_by": auth.FromContext(r.Context()).String(),
+	}).Infoln("Revoked API key")
+	w.WriteHeader(http.StatusNoContent)
+}
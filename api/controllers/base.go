@@ -1,16 +1,25 @@
 package controllers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
 
+	"NemWebGoApi/api/models"
 	"NemWebGoApi/internal/config"
 	"NemWebGoApi/internal/influxdb"
+	"NemWebGoApi/internal/metrics"
+	"NemWebGoApi/internal/ratelimit"
 	"NemWebGoApi/internal/sqlite"
 
 	"github.com/gorilla/mux"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
-	"github.com/rs/cors"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -18,36 +27,163 @@ type Server struct {
 	SQLDb    *sql.DB
 	InfluxDB influxdb2.Client
 	Router   *mux.Router
-	Config   *config.Config
+	Limiter  *ratelimit.Limiter
+
+	config atomic.Value // *config.Config, replaced on reload
+	cors   atomic.Value // http.Handler, the router wrapped in the current CORS policy
 }
 
 func (s *Server) Init(cfg *config.Config) error {
-	s.SQLDb = sqlite.New(cfg.SQLFilePath())
+	if err := cfg.RequireInflux(); err != nil {
+		return err
+	}
+	db, err := sqlite.New(cfg.SQLFilePath(), cfg.SQLiteAutoMigrate())
+	if err != nil {
+		return err
+	}
+	s.SQLDb = db
+	fts, err := sqlite.SearchIndexReady(context.Background(), s.SQLDb)
+	if err != nil {
+		log.Warnln("Error Checking Search Index:", err)
+	} else if !fts {
+		log.Warnln("Search index unavailable, /search falls back to matching in Go, build with -tags sqlite_fts5 and apply migration 0008")
+	}
+	models.SetSearchIndex(fts)
 	s.InfluxDB = influxdb.New(cfg.InfluxHost(), cfg.InfluxToken())
 	s.Router = mux.NewRouter()
-	s.Config = cfg
+	s.config.Store(cfg)
+	s.Limiter = ratelimit.New(cfg.RateLimitRPS(), cfg.RateLimitBurst())
 	s.initializeRoutes()
+	s.applyConfig(cfg)
+
+	if cfg.AuthEnabled() {
+		log.Infoln("API key authentication enabled")
+	}
+	metrics.OnScrape(s.refreshDataAge)
 	return nil
 }
 
-func (s *Server) Run(port string) {
-	corsWrapper := cors.New(cors.Options{
-		AllowedMethods: []string{"GET", "OPTIONS", "POST", "DELETE", "PUT", "PATCH"},
-		AllowedHeaders: []string{"Content-type", "Origin", "Accept", "*"},
-		// AllowedHeaders: []string{"Content-type", "Origin", "Accept", "Access-Control-Allow-Origin"},
-		AllowedOrigins: []string{
-			"http://127.0.0.1:3005",
-			"http://127.0.0.1:3000",
-			"http://127.0.0.1",
-			"https://aemodash.com",
-			"http://localhost:3005",
-			"http://localhost:3000",
-			"http://localhost",
-		},
-		AllowCredentials: true,
-		// Debug:            app.Cfg.Debug(),
-	})
-
-	log.Infoln("Listening to Port ", port)
-	log.Fatal(http.ListenAndServe(port, corsWrapper.Handler(s.Router)))
+// Config returns the configuration currently in effect
+func (s *Server) Config() *config.Config {
+	return s.config.Load().(*config.Config)
+}
+
+// ReloadConfig loads the configuration again and applies the settings that can change while running,
+// settings that need a restart keep their current values and are logged
+// If the new configuration is invalid the current one stays in effect
+func (s *Server) ReloadConfig() error {
+	next, changes, err := s.Config().Reload()
+	if err != nil {
+		metrics.ConfigReloads.Inc("failure")
+		return fmt.Errorf("server.ReloadConfig: %w", err)
+	}
+
+	if changes.Logging {
+		next.SetupLogger(os.Stdout)
+	}
+	s.applyConfig(next)
+	s.config.Store(next)
+	metrics.ConfigReloads.Inc("success")
+
+	if changes.Empty() {
+		log.Infoln("Config Reloaded: no changes")
+	}
+	for _, change := range changes.Applied {
+		log.Infoln("Config Reloaded:", change)
+	}
+	for _, change := range changes.RestartRequired {
+		log.Warnln("Config Change Requires Restart:", change)
+	}
+	return nil
+}
+
+// applyConfig pushes reloadable settings into the components that hold their own copy
+func (s *Server) applyConfig(cfg *config.Config) {
+	s.Limiter.SetLimits(cfg.RateLimitRPS(), cfg.RateLimitBurst())
+	models.SetUnitCacheTTL(cfg.UnitCacheTTL())
+	s.cors.Store(newCORSPolicy(cfg.CORS(), cfg.CORSRoutes()).Handler(s.Router))
+}
+
+// refreshDataAge updates the data age gauges from the latest demand point per region
+func (s *Server) refreshDataAge() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Config().HealthCheckTimeout())
+	defer cancel()
+
+	latest, err := models.ReadLatestDemandTimes(
+		ctx,
+		s.InfluxDB.QueryAPI(s.Config().InfluxOrg()),
+		s.Config().InfluxBucket(),
+		2*s.Config().DataStaleAfter(),
+	)
+	if err != nil {
+		log.Debugln("Error Refreshing Data Age Metrics:", err)
+		return
+	}
+
+	metrics.DataAge.Reset()
+	for region, t := range latest {
+		metrics.DataAge.Set(time.Since(t).Seconds(), region)
+	}
+}
+
+// Run serves the API on addr until ctx is cancelled, then stops accepting
+// connections and waits up to the configured shutdown timeout for in-flight requests
+func (s *Server) Run(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("server.Run: listen error: %w", err)
+	}
+	return s.serve(ctx, listener)
+}
+
+// serve is Run on a listener that is already open, closing it when done
+func (s *Server) serve(ctx context.Context, listener net.Listener) error {
+	httpServer := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.cors.Load().(http.Handler).ServeHTTP(w, r)
+		}),
+		ReadTimeout:       s.Config().HTTPReadTimeout(),
+		ReadHeaderTimeout: s.Config().HTTPReadHeaderTimeout(),
+		WriteTimeout:      s.Config().HTTPWriteTimeout(),
+		IdleTimeout:       s.Config().HTTPIdleTimeout(),
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Infoln("Listening to Port ", listener.Addr())
+		serveErr <- httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("server.Run: listen error: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	log.Infoln("Shutting down, waiting for in-flight requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.Config().ShutdownTimeout())
+	defer cancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("server.Run: shutdown error: %w", err)
+	}
+	log.Infoln("All requests drained")
+	return nil
+}
+
+// Close releases the database handles held by the server
+func (s *Server) Close() error {
+	if s.InfluxDB != nil {
+		s.InfluxDB.Close()
+	}
+	if s.SQLDb != nil {
+		if err := s.SQLDb.Close(); err != nil {
+			return fmt.Errorf("server.Close: sqlite close error: %w", err)
+		}
+	}
+	log.Infoln("Database connections closed")
+	return nil
 }
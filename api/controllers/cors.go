@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"NemWebGoApi/internal/config"
+
+	"github.com/rs/cors"
+	log "github.com/sirupsen/logrus"
+)
+
+// corsPolicy applies the CORS options of the longest matching route prefix,
+// falling back to the default options
+// It wraps the router rather than being router middleware so preflight
+// OPTIONS requests are answered even though routes only match their own methods
+type corsPolicy struct {
+	fallback *cors.Cors
+	routes   []corsRoute // longest prefix first
+}
+
+type corsRoute struct {
+	prefix string
+	cors   *cors.Cors
+}
+
+func newCORSPolicy(defaults config.CORSOptions, routes map[string]config.CORSOptions) *corsPolicy {
+	policy := &corsPolicy{fallback: newCORS("default", defaults)}
+	for prefix, opts := range routes {
+		policy.routes = append(policy.routes, corsRoute{prefix: prefix, cors: newCORS(prefix, opts)})
+	}
+	sort.Slice(policy.routes, func(i, j int) bool {
+		return len(policy.routes[i].prefix) > len(policy.routes[j].prefix)
+	})
+	return policy
+}
+
+func newCORS(name string, opts config.CORSOptions) *cors.Cors {
+	credentials := opts.AllowCredentials
+	for _, origin := range opts.AllowedOrigins {
+		if origin == "*" && credentials {
+			// rs/cors reflects the request origin for "*", which with credentials lets any site make authenticated requests
+			log.Warnf("CORS policy %s allows any origin, disabling credentials", name)
+			credentials = false
+		}
+	}
+
+	return cors.New(cors.Options{
+		AllowedOrigins:   opts.AllowedOrigins,
+		AllowedMethods:   opts.AllowedMethods,
+		AllowedHeaders:   opts.AllowedHeaders,
+		ExposedHeaders:   opts.ExposedHeaders,
+		AllowCredentials: credentials,
+		MaxAge:           opts.MaxAge,
+	})
+}
+
+// forPath returns the CORS handler for the request path, route prefixes are unversioned
+// so /data also applies to /v1/data and /v2/data
+func (p *corsPolicy) forPath(path string) *cors.Cors {
+	path = unversionedPath(path)
+	for _, route := range p.routes {
+		if path == route.prefix || strings.HasPrefix(path, strings.TrimSuffix(route.prefix, "/")+"/") {
+			return route.cors
+		}
+	}
+	return p.fallback
+}
+
+// unversionedPath returns path without a leading /v1 or /v2
+func unversionedPath(path string) string {
+	for _, prefix := range []string{"/v1", "/v2"} {
+		if path == prefix {
+			return "/"
+		}
+		if strings.HasPrefix(path, prefix+"/") {
+			return strings.TrimPrefix(path, prefix)
+		}
+	}
+	return path
+}
+
+// Handler wraps next with the CORS policy for each request
+func (p *corsPolicy) Handler(next http.Handler) http.Handler {
+	handlers := map[*cors.Cors]http.Handler{p.fallback: p.fallback.Handler(next)}
+	for _, route := range p.routes {
+		handlers[route.cors] = route.cors.Handler(next)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers[p.forPath(r.URL.Path)].ServeHTTP(w, r)
+	})
+}
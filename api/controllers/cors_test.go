@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"NemWebGoApi/internal/config"
+)
+
+func corsOptions(credentials bool, origins ...string) config.CORSOptions {
+	return config.CORSOptions{
+		AllowedOrigins:   origins,
+		AllowedMethods:   []string{"GET", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowCredentials: credentials,
+		MaxAge:           600,
+	}
+}
+
+// preflight sends an OPTIONS request for a cross origin GET of path through the policy
+func preflight(policy *corsPolicy, path string, origin string) *httptest.ResponseRecorder {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot) // preflight requests must not reach the router
+	})
+
+	r := httptest.NewRequest(http.MethodOptions, path, nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	w := httptest.NewRecorder()
+	policy.Handler(next).ServeHTTP(w, r)
+	return w
+}
+
+func TestCORSPreflight(t *testing.T) {
+	routes := map[string]config.CORSOptions{
+		"/data":            corsOptions(true, "https://data.example.com"),
+		"/data/generation": corsOptions(true, "https://generation.example.com"),
+	}
+
+	tests := []struct {
+		name        string
+		defaults    config.CORSOptions
+		routes      map[string]config.CORSOptions
+		path        string
+		origin      string
+		allowOrigin string // empty when the origin is refused
+		credentials bool
+	}{
+		{
+			name:        "wildcard subdomain matches",
+			defaults:    corsOptions(true, "https://*.example.com"),
+			path:        "/units",
+			origin:      "https://app.example.com",
+			allowOrigin: "https://app.example.com",
+			credentials: true,
+		},
+		{
+			name:     "wildcard subdomain does not match another domain",
+			defaults: corsOptions(true, "https://*.example.com"),
+			path:     "/units",
+			origin:   "https://app.example.org",
+		},
+		{
+			name:     "wildcard subdomain does not match a suffix without a dot",
+			defaults: corsOptions(true, "https://*.example.com"),
+			path:     "/units",
+			origin:   "https://notexample.com",
+		},
+		{
+			name:        "any origin disables credentials",
+			defaults:    corsOptions(true, "*"),
+			path:        "/units",
+			origin:      "https://anywhere.example.net",
+			allowOrigin: "*",
+			credentials: false,
+		},
+		{
+			name:        "listed origin keeps credentials",
+			defaults:    corsOptions(true, "https://app.example.com"),
+			path:        "/units",
+			origin:      "https://app.example.com",
+			allowOrigin: "https://app.example.com",
+			credentials: true,
+		},
+		{
+			name:        "route override allows its origin",
+			defaults:    corsOptions(true, "https://app.example.com"),
+			routes:      routes,
+			path:        "/data/demand",
+			origin:      "https://data.example.com",
+			allowOrigin: "https://data.example.com",
+			credentials: true,
+		},
+		{
+			name:     "route override replaces the default origins",
+			defaults: corsOptions(true, "https://app.example.com"),
+			routes:   routes,
+			path:     "/data/demand",
+			origin:   "https://app.example.com",
+		},
+		{
+			name:        "longest prefix wins",
+			defaults:    corsOptions(true, "https://app.example.com"),
+			routes:      routes,
+			path:        "/data/generation/grouped",
+			origin:      "https://generation.example.com",
+			allowOrigin: "https://generation.example.com",
+			credentials: true,
+		},
+		{
+			name:     "shorter prefix does not apply under a longer one",
+			defaults: corsOptions(true, "https://app.example.com"),
+			routes:   routes,
+			path:     "/data/generation",
+			origin:   "https://data.example.com",
+		},
+		{
+			name:        "route override applies under /v1",
+			defaults:    corsOptions(true, "https://app.example.com"),
+			routes:      routes,
+			path:        "/v1/data/demand",
+			origin:      "https://data.example.com",
+			allowOrigin: "https://data.example.com",
+			credentials: true,
+		},
+		{
+			name:        "route override applies under /v2",
+			defaults:    corsOptions(true, "https://app.example.com"),
+			routes:      routes,
+			path:        "/v2/data/demand",
+			origin:      "https://data.example.com",
+			allowOrigin: "https://data.example.com",
+			credentials: true,
+		},
+		{
+			name:        "longest prefix wins under /v2",
+			defaults:    corsOptions(true, "https://app.example.com"),
+			routes:      routes,
+			path:        "/v2/data/generation/stations",
+			origin:      "https://generation.example.com",
+			allowOrigin: "https://generation.example.com",
+			credentials: true,
+		},
+		{
+			name:     "route override replaces the default origins under /v1",
+			defaults: corsOptions(true, "https://app.example.com"),
+			routes:   routes,
+			path:     "/v1/data",
+			origin:   "https://app.example.com",
+		},
+		{
+			name:     "only whole version segments are stripped",
+			defaults: corsOptions(true, "https://app.example.com"),
+			routes:   routes,
+			path:     "/v2data/demand",
+			origin:   "https://data.example.com",
+		},
+		{
+			name:     "prefix matches whole path segments only",
+			defaults: corsOptions(true, "https://app.example.com"),
+			routes:   routes,
+			path:     "/database",
+			origin:   "https://data.example.com",
+		},
+		{
+			name:        "default applies outside the routes",
+			defaults:    corsOptions(true, "https://app.example.com"),
+			routes:      routes,
+			path:        "/units",
+			origin:      "https://app.example.com",
+			allowOrigin: "https://app.example.com",
+			credentials: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := preflight(newCORSPolicy(tt.defaults, tt.routes), tt.path, tt.origin)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusNoContent)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.credentials {
+				t.Errorf("Access-Control-Allow-Credentials = %v, want %v", got, tt.credentials)
+			}
+			if tt.allowOrigin == "" {
+				return
+			}
+			if got := w.Header().Get("Access-Control-Allow-Methods"); got != http.MethodGet {
+				t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, http.MethodGet)
+			}
+			if got := w.Header().Get("Access-Control-Max-Age"); got != "600" {
+				t.Errorf("Access-Control-Max-Age = %q, want %q", got, "600")
+			}
+		})
+	}
+}
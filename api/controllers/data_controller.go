@@ -2,111 +2,242 @@ package controllers
 
 import (
 	"NemWebGoApi/api/models"
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
-
-	log "github.com/sirupsen/logrus"
 )
 
 func (s *Server) GetDemandData(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.queryContext(r, s.Config().DemandQueryTimeout())
+	defer cancel()
+
+	filter := models.FilterMaptoDemandFilter(ctx, r.URL.Query())
+	if !s.validFill(w, r, filter.Fill) {
+		return
+	}
+	if !s.enforceQueryCost(w, r, filter.Range, &filter.Aggregate, regionSeries(filter.RegionID), models.DemandInterval) {
+		return
+	}
+
 	data, err := models.ReadDemandData(
-		s.InfluxDB.QueryAPI(s.Config.InfluxOrg()),
-		s.Config.InfluxBucket(),
-		models.FilterMaptoDemandFilter(r.URL.Query()),
+		ctx,
+		s.InfluxDB.QueryAPI(s.Config().InfluxOrg()),
+		s.Config().InfluxBucket(),
+		filter,
 	)
 
 	if err != nil {
-		log.Debugln("Error Getting Demand Data:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		s.respondQueryError(w, r, ctx, "Error Getting Demand Data:", err)
 		return
 	}
 
+	if apiVersion(r) == apiV2 {
+		s.respondV2(w, r, data, len(data), nil, http.StatusOK)
+		return
+	}
 	s.respond(w, r, data, http.StatusOK)
 	return
 }
 
 func (s *Server) GetRooftopData(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.queryContext(r, s.Config().RooftopQueryTimeout())
+	defer cancel()
+
+	filter := models.FilterMaptoRooftopFilter(ctx, r.URL.Query())
+	if !s.validFill(w, r, filter.Fill) {
+		return
+	}
+	if !s.enforceQueryCost(w, r, filter.Range, &filter.Aggregate, regionSeries(filter.RegionID), models.RooftopInterval) {
+		return
+	}
+
 	data, err := models.ReadRooftapData(
-		s.InfluxDB.QueryAPI(s.Config.InfluxOrg()),
-		s.Config.InfluxBucket(),
-		models.FilterMaptoRooftopFilter(r.URL.Query()),
+		ctx,
+		s.InfluxDB.QueryAPI(s.Config().InfluxOrg()),
+		s.Config().InfluxBucket(),
+		filter,
 	)
 
 	if err != nil {
-		log.Debugln("Error Getting Demand Data:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		s.respondQueryError(w, r, ctx, "Error Getting Rooftop Data:", err)
 		return
 	}
 
+	if apiVersion(r) == apiV2 {
+		s.respondV2(w, r, data, len(data), nil, http.StatusOK)
+		return
+	}
 	s.respond(w, r, data, http.StatusOK)
 	return
 }
 
 func (s *Server) GetGeneratingData(w http.ResponseWriter, r *http.Request) {
-	unit := models.Unit{}
+	ctx, cancel := s.queryContext(r, s.Config().GenerationQueryTimeout())
+	defer cancel()
 
-	// TODO: Think of better method to filter, very confusing already caught me out twice
-	// Currently if there are no DUID filters given it will then search
-	filter := models.FilterMapToGenerationFilter(r.URL.Query())
-	if len(filter.DuID.GetEq()) == 0 {
-		units, err := unit.ReadAll(
-			s.SQLDb,
-			models.ParseUnitFilterMap(r.URL.Query()),
-		)
-
-		if err != nil {
-			log.Debugln("Error Reading Units:", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		duids := []string{}
-		for _, val := range *units {
-			duids = append(duids, val.DuID)
-		}
+	filter := models.FilterMapToGenerationFilter(ctx, r.URL.Query())
+	if !s.validFill(w, r, filter.Fill) {
+		return
+	}
+	if err := filter.ResolveUnits(ctx, s.SQLDb, r.URL.Query()); err != nil {
+		s.respondUnitFilterError(w, r, ctx, err)
+		return
+	}
 
-		duids = append(duids, filter.DuID.GetEq()[:]...)
-		filter.DuID.SetEq(duids)
+	if !s.enforceQueryCost(w, r, filter.Range, &filter.Aggregate, len(filter.DuID.GetEq()), models.GenerationInterval) {
+		return
 	}
 
 	data, err := models.ReadGenerationData(
-		s.InfluxDB.QueryAPI(s.Config.InfluxOrg()),
-		s.Config.InfluxBucket(),
+		ctx,
+		s.InfluxDB.QueryAPI(s.Config().InfluxOrg()),
+		s.Config().InfluxBucket(),
 		filter,
 	)
 
 	if err != nil {
-		log.Debugln("Error Getting Demand Data:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		s.respondQueryError(w, r, ctx, "Error Getting Generation Data:", err)
 		return
 	}
 
+	if apiVersion(r) == apiV2 {
+		s.respondV2(w, r, data, len(data), nil, http.StatusOK)
+		return
+	}
 	s.respond(w, r, data, http.StatusOK)
 	return
 }
 
 func (s *Server) GetGenerationDataGrouped(w http.ResponseWriter, r *http.Request) {
-	filter := models.FilterMapToGenerationGroupedFilter(r.URL.Query())
+	ctx, cancel := s.queryContext(r, s.Config().GenerationGroupedQueryTimeout())
+	defer cancel()
+
+	filter := models.FilterMapToGenerationGroupedFilter(ctx, r.URL.Query())
+	if !s.validFill(w, r, filter.Fill) {
+		return
+	}
+	if err := models.ParseUnitFilterMap(r.URL.Query()).Location.Err(); err != nil {
+		s.respondUnitFilterError(w, r, ctx, err)
+		return
+	}
 
-	units, _, err := filter.GetAllGroupUnitCombinations(s.SQLDb, r.URL.Query())
+	units, _, err := filter.GetAllGroupUnitCombinations(ctx, s.SQLDb, r.URL.Query())
 	if err != nil {
-		log.Debugln("Error Getting Grouped Generation Data:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		s.respondQueryError(w, r, ctx, "Error Getting Grouped Generation Data:", err)
+		return
+	}
+
+	// Every member unit is read from InfluxDB before being summed per group
+	memberUnits := 0
+	for _, group := range units {
+		memberUnits += len(group)
+	}
+	if !s.enforceQueryCost(w, r, filter.Range, &filter.Aggregate, memberUnits, models.GenerationInterval) {
 		return
 	}
 
 	data, err := models.ReadGroupedGenerationData(
-		s.InfluxDB.QueryAPI(s.Config.InfluxOrg()),
-		s.Config.InfluxBucket(),
+		ctx,
+		s.InfluxDB.QueryAPI(s.Config().InfluxOrg()),
+		s.Config().InfluxBucket(),
 		filter,
 		units,
 	)
 
+	if errors.Is(err, models.ErrTooManyGroups) {
+		msg := fmt.Sprintf("%v: at most %d per query, filter to fewer units", models.ErrTooManyGroups, models.MaxGroupsPerQuery)
+		s.respond(w, r, map[string]string{"error": msg}, http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		log.Debugln("Error Getting Grouped Generation Data:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		s.respondQueryError(w, r, ctx, "Error Getting Grouped Generation Data:", err)
 		return
 	}
 
+	if apiVersion(r) == apiV2 {
+		s.respondV2(w, r, models.NewGroupSeries(data, units), len(data), nil, http.StatusOK)
+		return
+	}
 	s.respond(w, r, data, http.StatusOK)
 	return
 }
+
+// GetStationGenerationData returns generation summed per station over the stations' units,
+// the unit filters select which units and so which stations are included
+func (s *Server) GetStationGenerationData(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.queryContext(r, s.Config().GenerationGroupedQueryTimeout())
+	defer cancel()
+
+	filter := models.FilterMapToGenerationGroupedFilter(ctx, r.URL.Query())
+	if !s.validFill(w, r, filter.Fill) {
+		return
+	}
+
+	unitFilter := models.ParseUnitFilterMap(r.URL.Query())
+	if err := unitFilter.Location.Err(); err != nil {
+		s.respondUnitFilterError(w, r, ctx, err)
+		return
+	}
+	unit := models.Unit{}
+	units, err := unit.ReadAll(ctx, s.SQLDb, unitFilter)
+	if err != nil {
+		s.respondQueryError(w, r, ctx, "Error Reading Units:", err)
+		return
+	}
+
+	// Every member unit is read from InfluxDB before being summed per station
+	if !s.enforceQueryCost(w, r, filter.Range, &filter.Aggregate, len(*units), models.GenerationInterval) {
+		return
+	}
+
+	data, err := models.ReadStationGenerationData(
+		ctx,
+		s.InfluxDB.QueryAPI(s.Config().InfluxOrg()),
+		s.Config().InfluxBucket(),
+		filter,
+		*units,
+	)
+
+	if errors.Is(err, models.ErrTooManyGroups) {
+		msg := fmt.Sprintf("%v: at most %d per query, filter to fewer units", models.ErrTooManyGroups, models.MaxGroupsPerQuery)
+		s.respond(w, r, map[string]string{"error": msg}, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.respondQueryError(w, r, ctx, "Error Getting Station Generation Data:", err)
+		return
+	}
+
+	if apiVersion(r) == apiV2 {
+		s.respondV2(w, r, data, len(data), nil, http.StatusOK)
+		return
+	}
+	s.respond(w, r, data, http.StatusOK)
+}
+
+// validFill writes 400 for an invalid fill parameter, returning false if the request should not continue
+func (s *Server) validFill(w http.ResponseWriter, r *http.Request, fill models.FillFilter) bool {
+	if err := fill.Err(); err != nil {
+		s.respond(w, r, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// respondUnitFilterError writes 400 for invalid location filters and no data when the
+// unit filters match no units, otherwise the unit query failed
+func (s *Server) respondUnitFilterError(w http.ResponseWriter, r *http.Request, ctx context.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidLocationFilter):
+		s.respond(w, r, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+	case errors.Is(err, models.ErrNoMatchingUnits):
+		if apiVersion(r) == apiV2 {
+			s.respondV2(w, r, []models.GenerationDataPoint{}, 0, nil, http.StatusOK)
+			return
+		}
+		s.respond(w, r, []models.GenerationDataPoint{}, http.StatusOK)
+	default:
+		s.respondQueryError(w, r, ctx, "Error Reading Units:", err)
+	}
+}
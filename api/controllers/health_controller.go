@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"NemWebGoApi/api/models"
+)
+
+const (
+	healthStatusOK          = "ok"
+	healthStatusStale       = "stale"
+	healthStatusUnavailable = "unavailable"
+)
+
+// DependencyStatus is the result of checking a single dependency
+type DependencyStatus struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// FreshnessStatus reports the age of the most recent demand data
+type FreshnessStatus struct {
+	Status     string                     `json:"status"`
+	Latest     *time.Time                 `json:"latest,omitempty"`
+	AgeSeconds int64                      `json:"age_seconds,omitempty"`
+	Regions    map[string]RegionFreshness `json:"regions,omitempty"`
+	Error      string                     `json:"error,omitempty"`
+}
+
+// RegionFreshness is the latest demand point for a single region
+type RegionFreshness struct {
+	Latest     time.Time `json:"latest"`
+	AgeSeconds int64     `json:"age_seconds"`
+}
+
+// ReadinessReport is returned by /readyz
+type ReadinessReport struct {
+	Status    string           `json:"status"`
+	InfluxDB  DependencyStatus `json:"influxdb"`
+	SQLite    DependencyStatus `json:"sqlite"`
+	Freshness FreshnessStatus  `json:"freshness"`
+}
+
+// GetLiveness reports that the process is up and serving requests,
+// it does not check any dependencies
+func (s *Server) GetLiveness(w http.ResponseWriter, r *http.Request) {
+	s.respond(w, r, map[string]string{"status": healthStatusOK}, http.StatusOK)
+}
+
+// GetReadiness checks that InfluxDB and SQLite are reachable and reports data freshness,
+// returning 503 if either database is unavailable
+func (s *Server) GetReadiness(w http.ResponseWriter, r *http.Request) {
+	report := ReadinessReport{
+		Status:    healthStatusOK,
+		InfluxDB:  s.checkInflux(r.Context()),
+		SQLite:    s.checkSQLite(r.Context()),
+		Freshness: s.checkFreshness(r.Context()),
+	}
+
+	status := http.StatusOK
+	if report.InfluxDB.Status != healthStatusOK || report.SQLite.Status != healthStatusOK {
+		report.Status = healthStatusUnavailable
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	s.respond(w, r, report, status)
+}
+
+func (s *Server) checkInflux(parent context.Context) DependencyStatus {
+	ctx, cancel := context.WithTimeout(parent, s.Config().HealthCheckTimeout())
+	defer cancel()
+
+	start := time.Now()
+	ok, err := s.InfluxDB.Ping(ctx)
+	if err == nil && !ok {
+		err = errors.New("ping failed")
+	}
+	return newDependencyStatus(start, err)
+}
+
+func (s *Server) checkSQLite(parent context.Context) DependencyStatus {
+	ctx, cancel := context.WithTimeout(parent, s.Config().HealthCheckTimeout())
+	defer cancel()
+
+	start := time.Now()
+	// sqlite3 creates missing files on open, so check the file exists before querying
+	if _, err := os.Stat(s.Config().SQLFilePath()); err != nil {
+		return newDependencyStatus(start, fmt.Errorf("database file: %w", err))
+	}
+	return newDependencyStatus(start, models.PingUnits(ctx, s.SQLDb))
+}
+
+func (s *Server) checkFreshness(parent context.Context) FreshnessStatus {
+	ctx, cancel := context.WithTimeout(parent, s.Config().HealthCheckTimeout())
+	defer cancel()
+
+	// Look back a little further than the stale threshold so stale data is still reported
+	latestByRegion, err := models.ReadLatestDemandTimes(
+		ctx,
+		s.InfluxDB.QueryAPI(s.Config().InfluxOrg()),
+		s.Config().InfluxBucket(),
+		2*s.Config().DataStaleAfter(),
+	)
+	if err != nil {
+		return FreshnessStatus{Status: healthStatusUnavailable, Error: err.Error()}
+	}
+
+	freshness := FreshnessStatus{
+		Status:  healthStatusStale,
+		Regions: make(map[string]RegionFreshness),
+	}
+
+	now := time.Now()
+	var latest time.Time
+	for region, t := range latestByRegion {
+		freshness.Regions[region] = RegionFreshness{
+			Latest:     t,
+			AgeSeconds: int64(now.Sub(t).Seconds()),
+		}
+		if t.After(latest) {
+			latest = t
+		}
+	}
+
+	if !latest.IsZero() {
+		freshness.Latest = &latest
+		freshness.AgeSeconds = int64(now.Sub(latest).Seconds())
+		if now.Sub(latest) <= s.Config().DataStaleAfter() {
+			freshness.Status = healthStatusOK
+		}
+	}
+	return freshness
+}
+
+func newDependencyStatus(start time.Time, err error) DependencyStatus {
+	status := DependencyStatus{
+		Status:    healthStatusOK,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		status.Status = healthStatusUnavailable
+		status.Error = err.Error()
+	}
+	return status
+}
@@ -1,21 +1,30 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
-	log "github.com/sirupsen/logrus"
+	"NemWebGoApi/internal/logging"
 )
 
+// envelope wraps response data with metadata about it, such as totals and cursors
+type envelope struct {
+	Data interface{}            `json:"data"`
+	Meta map[string]interface{} `json:"meta"`
+}
+
 func (s *Server) respond(w http.ResponseWriter, r *http.Request, data interface{}, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if data != nil {
 		err := json.NewEncoder(w).Encode(data)
 		if err != nil {
-			log.Warnln("Error Encoding JSON:", err)
+			logging.FromContext(r.Context()).Warnln("Error Encoding JSON:", err)
 		}
 	}
 }
@@ -33,3 +42,28 @@ func (s *Server) decode(w http.ResponseWriter, r *http.Request, v interface{}) e
 		}
 	}
 }
+
+// queryContext derives a context for store queries from the request, so queries are
+// cancelled when the client disconnects or the endpoint's timeout elapses
+func (s *Server) queryContext(r *http.Request, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// respondQueryError writes the status for a failed store query,
+// 504 if the query deadline was exceeded otherwise 500
+func (s *Server) respondQueryError(w http.ResponseWriter, r *http.Request, ctx context.Context, msg string, err error) {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.Is(err, context.DeadlineExceeded):
+		logging.FromContext(r.Context()).Warnln(msg, "query timed out:", err)
+		w.WriteHeader(http.StatusGatewayTimeout)
+	case errors.Is(r.Context().Err(), context.Canceled):
+		// Client has gone away, nobody to respond to
+		logging.FromContext(r.Context()).Debugln(msg, "request cancelled:", err)
+	default:
+		logging.FromContext(r.Context()).Debugln(msg, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"NemWebGoApi/api/models"
+	"NemWebGoApi/internal/logging"
+)
+
+// Modes accepted by QUERY_COST_MODE
+const (
+	costModeReject     = "reject"
+	costModeDownsample = "downsample"
+)
+
+// enforceQueryCost estimates the points a time series query will read and applies the configured budget,
+// either downsampling the aggregate window or responding 429 with an explanation
+// Returns false if the request was rejected and a response has been written
+// agg is nil for queries that read every point whatever the window, these are rejected in either mode
+func (s *Server) enforceQueryCost(w http.ResponseWriter, r *http.Request, rng models.RangeFilter, agg *models.AggregateFilter, series int, interval time.Duration) bool {
+	budget := s.Config().QueryCostBudget()
+	if budget <= 0 {
+		return true
+	}
+
+	var window models.AggregateFilter
+	suggestion := "shorten range.start/range.stop, set aggregate.every and aggregate.fn, or filter to fewer units or regions"
+	if agg != nil {
+		window = *agg
+	} else {
+		suggestion = "shorten range.start/range.stop"
+	}
+	cost := models.EstimateCost(rng, window, series, interval)
+	w.Header().Set("X-Query-Cost", fmt.Sprintf("%d", cost.Points))
+	if cost.Points <= budget {
+		return true
+	}
+
+	if agg != nil && s.Config().QueryCostMode() == costModeDownsample {
+		if every, ok := agg.Downsample(cost, budget); ok {
+			logging.FromContext(r.Context()).Debugf("Downsampled query to %s: %s", every, cost)
+			w.Header().Set("X-Query-Downsampled", every)
+			return true
+		}
+	}
+
+	logging.FromContext(r.Context()).Debugln("Rejected query over budget:", cost)
+	s.respond(w, r, map[string]interface{}{
+		"error":            "query exceeds cost budget",
+		"explanation":      fmt.Sprintf("estimated %s, budget is %d points", cost, budget),
+		"estimated_points": cost.Points,
+		"budget":           budget,
+		"suggestion":       suggestion,
+	}, http.StatusTooManyRequests)
+	return false
+}
+
+// regionSeries returns how many region series a demand or rooftop query covers
+func regionSeries(filter models.StringFilter) int {
+	if n := len(filter.GetEq()); n > 0 {
+		return n
+	}
+	return models.NEMRegionCount
+}
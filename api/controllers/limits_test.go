@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// TestQualityQueryCost checks /quality is costed at a series per region plus one per unit in the
+// regions, and the unknown units without a region filter, over every interval of the range, and
+// rejected over budget before InfluxDB is queried
+func TestQualityQueryCost(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		path   string
+		points string
+	}{
+		// 5 regions, 1 unit and 100 unknown units over 7 days of 5 minute intervals
+		{"every region", costModeReject, "/v2/quality", "213696"},
+		// rejected even when the mode would downsample other queries
+		{"downsample mode", costModeDownsample, "/v2/quality", "213696"},
+		// 1 region and its unit over a day
+		{"one region", costModeReject, "/v2/quality?region_id.eq=NSW1&range.start=-1d", "576"},
+		// a region without units
+		{"region without units", costModeReject, "/v2/quality?region_id.eq=SA1&range.start=-1d", "288"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newContractServer(t, "--query-cost-budget", "100", "--query-cost-mode", tt.mode)
+
+			w := get(s, tt.path)
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusTooManyRequests, w.Body)
+			}
+			if got := w.Header().Get("X-Query-Cost"); got != tt.points {
+				t.Errorf("X-Query-Cost = %q, want %q", got, tt.points)
+			}
+
+			var body struct {
+				Suggestion string `json:"suggestion"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body: %v: %s", err, w.Body)
+			}
+			if body.Suggestion != "shorten range.start/range.stop" {
+				t.Errorf("suggestion = %q, want only the range to be shortened", body.Suggestion)
+			}
+		})
+	}
+}
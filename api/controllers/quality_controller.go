@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"net/http"
+
+	"NemWebGoApi/api/models"
+)
+
+func (s *Server) GetQuality(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.queryContext(r, s.Config().QualityQueryTimeout())
+	defer cancel()
+
+	filter, err := models.ParseQualityFilterMap(r.URL.Query())
+	if err != nil {
+		s.respond(w, r, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	// The report reads every point of the range for each region and unit so cannot be downsampled
+	series, err := models.QualitySeries(ctx, s.SQLDb, filter)
+	if err != nil {
+		s.respondQueryError(w, r, ctx, "Error Getting Quality Report:", err)
+		return
+	}
+	if !s.enforceQueryCost(w, r, filter.Range, nil, series, models.GenerationInterval) {
+		return
+	}
+
+	report, err := models.ReadQualityReport(
+		ctx,
+		s.InfluxDB.QueryAPI(s.Config().InfluxOrg()),
+		s.SQLDb,
+		s.Config().InfluxBucket(),
+		filter,
+	)
+	if err != nil {
+		s.respondQueryError(w, r, ctx, "Error Getting Quality Report:", err)
+		return
+	}
+
+	s.respondV2(w, r, report, -1, nil, http.StatusOK)
+}
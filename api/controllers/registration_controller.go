@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"NemWebGoApi/api/models"
+	"NemWebGoApi/internal/logging"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxRegistrationUpload is the largest registration list accepted, AEMO's workbook is a few MB
+const maxRegistrationUpload = 32 << 20
+
+// ImportRegistration diffs the CSV or XLSX registration list in the request body against the units,
+// writing the inserts and updates only when apply=true
+func (s *Server) ImportRegistration(w http.ResponseWriter, r *http.Request) {
+	apply := false
+	if v := r.URL.Query().Get("apply"); v != "" {
+		var err error
+		if apply, err = strconv.ParseBool(v); err != nil {
+			s.respond(w, r, map[string]string{"error": "apply must be true or false"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRegistrationUpload))
+	if err != nil {
+		s.respond(w, r, map[string]string{"error": "registration list larger than 32MB"}, http.StatusRequestEntityTooLarge)
+		return
+	}
+	rows, err := models.ParseRegistration(data, r.URL.Query().Get("sheet"))
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidRegistration) {
+			s.respond(w, r, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		logging.FromContext(r.Context()).Warnln("Error Reading Registration List:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	result, err := models.ImportRegistration(r.Context(), s.SQLDb, rows, apply, s.actor(r))
+	if err != nil {
+		logging.FromContext(r.Context()).Warnln("Error Importing Registration List:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if result.Applied {
+		logging.FromContext(r.Context()).WithFields(log.Fields{
+			"audit":      true,
+			"action":     "import",
+			"inserted":   result.Inserted,
+			"updated":    result.Updated,
+			"changed_by": s.actor(r),
+		}).Infoln("Imported registration list")
+	}
+	s.respond(w, r, result, http.StatusOK)
+}
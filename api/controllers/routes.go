@@ -1,19 +1,78 @@
 package controllers
 
-import "NemWebGoApi/api/middlewares"
+import (
+	"NemWebGoApi/api/middlewares"
+	"NemWebGoApi/internal/auth"
+	"NemWebGoApi/internal/metrics"
+
+	"github.com/gorilla/mux"
+)
 
 func (s *Server) initializeRoutes() {
-	s.Router.Use(middlewares.LoggingMW)
-	s.Router.Use(middlewares.TimingMW)
+	s.Router.Use(middlewares.RequestIDMW)
+	s.Router.Use(middlewares.TracingMW)
+	s.Router.Use(middlewares.AccessLogMW(s.Config().TrustProxyHeaders()))
+	s.Router.Use(middlewares.MetricsMW)
+	s.Router.Use(s.authenticate)
+	s.Router.Use(middlewares.AuditMW(s.Config().TrustProxyHeaders()))
+
+	s.Router.HandleFunc("/healthz", s.GetLiveness).Methods("GET")
+	s.Router.HandleFunc("/readyz", s.GetReadiness).Methods("GET")
+	s.Router.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	// v1 is frozen and also served at the root, both deprecated in favour of v2
+	s.mountVersion(s.Router, apiV1, middlewares.DeprecationMW("", "/v2"))
+	s.mountVersion(s.Router.PathPrefix("/v1").Subrouter(), apiV1, middlewares.DeprecationMW("/v1", "/v2"))
+	s.mountVersion(s.Router.PathPrefix("/v2").Subrouter(), apiV2)
+
+	adminRouter := s.Router.PathPrefix("/admin").Subrouter()
+	adminRouter.HandleFunc("/keys", s.requireAdmin(s.GetAllAPIKeys)).Methods("GET")
+	adminRouter.HandleFunc("/keys", s.requireAdmin(s.CreateAPIKey)).Methods("POST")
+	adminRouter.HandleFunc("/keys/{id:[0-9]+}", s.requireAdmin(s.RevokeAPIKey)).Methods("DELETE")
+	adminRouter.HandleFunc("/units/import", s.requireAdmin(s.ImportRegistration)).Methods("POST")
+}
+
+// mountVersion registers the versioned units, data and stations routes on router, and for v2
+// the search and quality routes
+func (s *Server) mountVersion(router *mux.Router, version int, mws ...mux.MiddlewareFunc) {
+	rateLimit := middlewares.RateLimitMW(s.Limiter, s.Config().TrustProxyHeaders())
+	mws = append(append([]mux.MiddlewareFunc{withAPIVersion(version)}, mws...), rateLimit)
+
+	unitRouter := router.PathPrefix("/units").Subrouter()
+	unitRouter.Use(mws...)
+	unitRouter.HandleFunc("", s.requireScope(auth.ScopeUnitsRead, s.GetAllUnits)).Methods("GET")
+	unitRouter.HandleFunc("/{duid}", s.requireScope(auth.ScopeUnitsRead, s.GetUnit)).Methods("GET")
+	unitRouter.HandleFunc("/{duid}/history", s.requireScope(auth.ScopeUnitsRead, s.GetUnitHistory)).Methods("GET")
+	unitRouter.HandleFunc("/{duid}", s.requireAuthenticated(auth.ScopeUnitsWrite, s.CreateUnit)).Methods("POST")
+	unitRouter.HandleFunc("/{duid}", s.requireAuthenticated(auth.ScopeUnitsWrite, s.UpdateUnit)).Methods("PUT")
+	unitRouter.HandleFunc("/{duid}", s.requireAuthenticated(auth.ScopeUnitsWrite, s.PatchUnit)).Methods("PATCH")
+	unitRouter.HandleFunc("/{duid}", s.requireAuthenticated(auth.ScopeUnitsWrite, s.DeleteUnit)).Methods("DELETE")
+
+	dataRouter := router.PathPrefix("/data").Subrouter()
+	dataRouter.Use(mws...)
+	dataRouter.HandleFunc("/demand", s.requireScope(auth.ScopeDataRead, s.GetDemandData)).Methods("GET")
+
+	dataRouter.HandleFunc("/rooftop", s.requireScope(auth.ScopeDataRead, s.GetRooftopData)).Methods("GET")
+
+	dataRouter.HandleFunc("/generation", s.requireScope(auth.ScopeDataRead, s.GetGeneratingData)).Methods("GET")
+	dataRouter.HandleFunc("/generation/grouped", s.requireScope(auth.ScopeDataRead, s.GetGenerationDataGrouped)).Methods("GET")
+	dataRouter.HandleFunc("/generation/stations", s.requireScope(auth.ScopeDataRead, s.GetStationGenerationData)).Methods("GET")
 
-	unitRouter := s.Router.PathPrefix("/units").Subrouter()
-	unitRouter.HandleFunc("", s.GetAllUnits).Methods("GET")
+	stationRouter := router.PathPrefix("/stations").Subrouter()
+	stationRouter.Use(mws...)
+	stationRouter.HandleFunc("", s.requireScope(auth.ScopeUnitsRead, s.GetAllStations)).Methods("GET")
+	stationRouter.HandleFunc("/{name}", s.requireScope(auth.ScopeUnitsRead, s.GetStation)).Methods("GET")
 
-	dataRouter := s.Router.PathPrefix("/data").Subrouter()
-	dataRouter.HandleFunc("/demand", s.GetDemandData).Methods("GET")
+	// v1 is frozen, endpoints added since are only served under v2
+	if version == apiV1 {
+		return
+	}
 
-	dataRouter.HandleFunc("/rooftop", s.GetRooftopData).Methods("GET")
+	searchRouter := router.PathPrefix("/search").Subrouter()
+	searchRouter.Use(mws...)
+	searchRouter.HandleFunc("", s.requireScope(auth.ScopeUnitsRead, s.GetSearch)).Methods("GET")
 
-	dataRouter.HandleFunc("/generation", s.GetGeneratingData).Methods("GET")
-	dataRouter.HandleFunc("/generation/grouped", s.GetGenerationDataGrouped).Methods("GET")
+	qualityRouter := router.PathPrefix("/quality").Subrouter()
+	qualityRouter.Use(mws...)
+	qualityRouter.HandleFunc("", s.requireScope(auth.ScopeDataRead, s.GetQuality)).Methods("GET")
 }
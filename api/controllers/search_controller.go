@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"NemWebGoApi/api/models"
+)
+
+// GetSearch returns the units and stations best matching q, for autocomplete and lookup
+func (s *Server) GetSearch(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.queryContext(r, s.Config().UnitsQueryTimeout())
+	defer cancel()
+
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		s.respond(w, r, map[string]string{"error": "q is required"}, http.StatusBadRequest)
+		return
+	}
+
+	limit := models.DefaultSearchLimit
+	if val := r.URL.Query().Get("limit"); val != "" {
+		var err error
+		limit, err = strconv.Atoi(val)
+		if err != nil || limit < 1 || limit > models.MaxSearchLimit {
+			s.respond(w, r, map[string]string{"error": "limit must be between 1 and " + strconv.Itoa(models.MaxSearchLimit)}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	results, err := models.Search(ctx, s.SQLDb, q, limit)
+	if err != nil {
+		s.respondQueryError(w, r, ctx, "Error Searching Units:", err)
+		return
+	}
+
+	s.respondV2(w, r, results, -1, nil, http.StatusOK)
+}
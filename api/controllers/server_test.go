@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"NemWebGoApi/internal/config"
+)
+
+// newTestServer returns a server on a new SQLite database in a temporary directory, InfluxDB
+// is not reachable so only handlers that do not query it can be exercised
+// args are configuration flags, e.g. "--http-shutdown-timeout", "5s"
+func newTestServer(t *testing.T, args ...string) *Server {
+	t.Helper()
+
+	args = append([]string{
+		"--sqlite-path", filepath.Join(t.TempDir(), "test.sqlite"),
+		"--influx-url", "http://127.0.0.1:1",
+		"--influx-token", "test",
+	}, args...)
+	cfg, err := config.Load(args)
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+
+	s := &Server{}
+	if err := s.Init(cfg); err != nil {
+		t.Fatalf("Server.Init: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Errorf("Server.Close: %v", err)
+		}
+	})
+	return s
+}
+
+func TestServeDrainsInFlightRequestsOnShutdown(t *testing.T) {
+	s := newTestServer(t, "--http-shutdown-timeout", "5s")
+
+	started := make(chan struct{})
+	s.Router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(500 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, shutdown := context.WithCancel(context.Background())
+	defer shutdown()
+	runErr := make(chan error, 1)
+	go func() { runErr <- s.serve(ctx, listener) }()
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	response := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err != nil {
+			response <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		response <- result{status: resp.StatusCode, body: string(body), err: err}
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow request was not received")
+	}
+	shutdown()
+	shutdownAt := time.Now()
+
+	select {
+	case res := <-response:
+		if res.err != nil {
+			t.Fatalf("in-flight request failed during shutdown: %v", res.err)
+		}
+		if res.status != http.StatusOK || res.body != "done" {
+			t.Fatalf("in-flight request got %d %q, want 200 \"done\"", res.status, res.body)
+		}
+	case <-time.After(s.Config().ShutdownTimeout()):
+		t.Fatal("in-flight request did not complete within the shutdown timeout")
+	}
+
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Fatalf("serve returned %v, want nil", err)
+		}
+		if elapsed := time.Since(shutdownAt); elapsed > s.Config().ShutdownTimeout() {
+			t.Fatalf("serve took %s to return, longer than the shutdown timeout", elapsed)
+		}
+	case <-time.After(s.Config().ShutdownTimeout()):
+		t.Fatal("serve did not return within the shutdown timeout")
+	}
+
+	if _, err := http.Get("http://" + listener.Addr().String() + "/slow"); err == nil {
+		t.Fatal("server accepted a request after shutdown")
+	}
+}
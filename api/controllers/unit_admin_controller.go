@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"NemWebGoApi/api/models"
+	"NemWebGoApi/internal/auth"
+	"NemWebGoApi/internal/logging"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+func (s *Server) GetUnitHistory(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.queryContext(r, s.Config().UnitsQueryTimeout())
+	defer cancel()
+
+	history, err := models.ReadUnitHistory(ctx, s.SQLDb, mux.Vars(r)["duid"])
+	if err != nil {
+		s.respondQueryError(w, r, ctx, "Error Reading Unit History:", err)
+		return
+	}
+	if apiVersion(r) == apiV2 {
+		views := make([]models.UnitChangeView, 0, len(history))
+		for _, change := range history {
+			views = append(views, change.View())
+		}
+		s.respondV2(w, r, views, len(views), nil, http.StatusOK)
+		return
+	}
+	s.respond(w, r, history, http.StatusOK)
+}
+
+func (s *Server) CreateUnit(w http.ResponseWriter, r *http.Request) {
+	var body models.UnitPatch
+	if err := s.decode(w, r, &body); err != nil {
+		s.respond(w, r, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	unit, err := models.CreateUnit(r.Context(), s.SQLDb, body.Apply(models.Unit{DuID: mux.Vars(r)["duid"]}), s.actor(r))
+	if err != nil {
+		s.respondUnitError(w, r, err)
+		return
+	}
+	s.auditUnit(r, models.UnitCreated, unit.DuID)
+	s.respondUnit(w, r, unit, http.StatusCreated)
+}
+
+func (s *Server) UpdateUnit(w http.ResponseWriter, r *http.Request) {
+	ifMatch, ok := s.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	var body models.UnitPatch
+	if err := s.decode(w, r, &body); err != nil {
+		s.respond(w, r, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	duid := mux.Vars(r)["duid"]
+	unit, err := models.UpdateUnit(r.Context(), s.SQLDb, duid, body.Apply(models.Unit{}), ifMatch, s.actor(r))
+	if err != nil {
+		s.respondUnitError(w, r, err)
+		return
+	}
+	s.auditUnit(r, models.UnitUpdated, duid)
+	s.respondUnit(w, r, unit, http.StatusOK)
+}
+
+func (s *Server) PatchUnit(w http.ResponseWriter, r *http.Request) {
+	ifMatch, ok := s.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	var body models.UnitPatch
+	if err := s.decode(w, r, &body); err != nil {
+		s.respond(w, r, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	duid := mux.Vars(r)["duid"]
+	unit, err := models.PatchUnit(r.Context(), s.SQLDb, duid, body, ifMatch, s.actor(r))
+	if err != nil {
+		s.respondUnitError(w, r, err)
+		return
+	}
+	s.auditUnit(r, models.UnitUpdated, duid)
+	s.respondUnit(w, r, unit, http.StatusOK)
+}
+
+func (s *Server) DeleteUnit(w http.ResponseWriter, r *http.Request) {
+	ifMatch, ok := s.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	duid := mux.Vars(r)["duid"]
+	if err := models.DeleteUnit(r.Context(), s.SQLDb, duid, ifMatch, s.actor(r)); err != nil {
+		s.respondUnitError(w, r, err)
+		return
+	}
+	s.auditUnit(r, models.UnitDeleted, duid)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondUnit writes a written unit with its ETag
+func (s *Server) respondUnit(w http.ResponseWriter, r *http.Request, unit *models.Unit, status int) {
+	w.Header().Set("ETag", unit.ETag())
+	if apiVersion(r) == apiV2 {
+		s.respondV2(w, r, unit.View(), -1, nil, status)
+		return
+	}
+	s.respond(w, r, unit, status)
+}
+
+// requireIfMatch returns the If-Match header, responding 428 if it is missing
+// so clients cannot overwrite changes they have not seen
+func (s *Server) requireIfMatch(w http.ResponseWriter, r *http.Request) (string, bool) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		s.respond(w, r, map[string]string{"error": "If-Match header required, use the ETag from GET /units/{duid}"}, http.StatusPreconditionRequired)
+		return "", false
+	}
+	return ifMatch, true
+}
+
+// respondUnitError maps unit write errors to statuses
+func (s *Server) respondUnitError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *models.UnitValidationError
+	switch {
+	case errors.As(err, &invalid):
+		s.respond(w, r, map[string]interface{}{"error": "invalid unit", "fields": invalid.Fields}, http.StatusUnprocessableEntity)
+	case errors.Is(err, models.ErrUnitNotFound):
+		s.respond(w, r, map[string]string{"error": err.Error()}, http.StatusNotFound)
+	case errors.Is(err, models.ErrUnitExists):
+		s.respond(w, r, map[string]string{"error": err.Error()}, http.StatusConflict)
+	case errors.Is(err, models.ErrUnitPreconditionFailed):
+		s.respond(w, r, map[string]string{"error": err.Error()}, http.StatusPreconditionFailed)
+	default:
+		logging.FromContext(r.Context()).Warnln("Error Writing Unit:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// actor identifies who made a change in unit_history
+func (s *Server) actor(r *http.Request) string {
+	return auth.FromContext(r.Context()).String()
+}
+
+func (s *Server) auditUnit(r *http.Request, action string, duid string) {
+	logging.FromContext(r.Context()).WithFields(log.Fields{
+		"audit":      true,
+		"action":     action,
+		"duid":       duid,
+		"changed_by": s.actor(r),
+	}).Infoln("Changed unit")
+}
@@ -2,19 +2,115 @@ package controllers
 
 import (
 	"NemWebGoApi/api/models"
+	"NemWebGoApi/internal/logging"
+	"encoding/json"
+	"errors"
 	"net/http"
-
-	log "github.com/sirupsen/logrus"
 )
 
+// GetAllUnits returns units matching the unit filters, optionally sorted and with only the fields asked for
+// In v1 asking for a page with limit or cursor returns the envelope with version 2 field names,
+// otherwise every unit is returned as a bare array with the original field names, v2 always uses the envelope
+// format=geojson returns a FeatureCollection instead, with paging in its meta member
 func (s *Server) GetAllUnits(w http.ResponseWriter, r *http.Request) {
-	unit := models.Unit{}
-	units, err := unit.ReadAll(s.SQLDb, models.ParseUnitFilterMap(r.URL.Query()))
+	ctx, cancel := s.queryContext(r, s.Config().UnitsQueryTimeout())
+	defer cancel()
+
+	query, err := models.ParseUnitQuery(r.URL.Query())
 	if err != nil {
-		log.Debugln("Error Reading Units:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		s.respond(w, r, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "geojson" {
+		s.respond(w, r, map[string]string{"error": "format must be json or geojson"}, http.StatusBadRequest)
+		return
+	}
+
+	if apiVersion(r) == apiV1 && format != "geojson" && !query.Paginated() && len(query.Sort) == 0 && len(query.Fields) == 0 {
+		unit := models.Unit{}
+		units, err := unit.ReadAll(ctx, s.SQLDb, query.Filter)
+		if err != nil {
+			s.respondQueryError(w, r, ctx, "Error Reading Units:", err)
+			return
+		}
+		s.respond(w, r, units, http.StatusOK)
+		return
+	}
+
+	page, err := models.ReadUnitPage(ctx, s.SQLDb, query)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidUnitQuery) {
+			s.respond(w, r, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+			return
+		}
+		s.respondQueryError(w, r, ctx, "Error Reading Units:", err)
+		return
+	}
+
+	if format == "geojson" {
+		collection := models.FeatureCollection{Type: "FeatureCollection", Features: models.UnitFeatures(page.Units, query.Fields)}
+		if query.Paginated() || apiVersion(r) == apiV2 {
+			collection.Meta = map[string]interface{}{"total": page.Total, "count": len(page.Units), "next_cursor": page.NextCursor}
+			if query.Limit > 0 {
+				collection.Meta["limit"] = query.Limit
+			}
+		}
+		s.respondGeoJSON(w, r, collection)
 		return
 	}
-	s.respond(w, r, units, http.StatusOK)
-	return
+
+	if apiVersion(r) == apiV2 {
+		meta := map[string]interface{}{"total": page.Total, "next_cursor": page.NextCursor}
+		if query.Limit > 0 {
+			meta["limit"] = query.Limit
+		}
+		s.respondV2(w, r, unitData(page.Units, query.Fields, false), len(page.Units), meta, http.StatusOK)
+		return
+	}
+
+	if !query.Paginated() {
+		s.respond(w, r, unitData(page.Units, query.Fields, true), http.StatusOK)
+		return
+	}
+
+	s.respond(w, r, envelope{
+		Data: unitData(page.Units, query.Fields, false),
+		Meta: map[string]interface{}{
+			"schema":      2,
+			"total":       page.Total,
+			"count":       len(page.Units),
+			"limit":       query.Limit,
+			"next_cursor": page.NextCursor,
+		},
+	}, http.StatusOK)
+}
+
+// respondGeoJSON writes a GeoJSON document, which is never wrapped in the v2 envelope
+func (s *Server) respondGeoJSON(w http.ResponseWriter, r *http.Request, data interface{}) {
+	w.Header().Set("Content-Type", "application/geo+json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logging.FromContext(r.Context()).Warnln("Error Encoding JSON:", err)
+	}
+}
+
+// unitData returns the units in the original schema if legacy, otherwise version 2,
+// with only the given fields if there are any
+func unitData(units []models.Unit, fields []string, legacy bool) interface{} {
+	if len(fields) != 0 {
+		selected := make([]map[string]interface{}, 0, len(units))
+		for _, unit := range units {
+			selected = append(selected, unit.SelectFields(fields, legacy))
+		}
+		return selected
+	}
+	if legacy {
+		return units
+	}
+	views := make([]models.UnitView, 0, len(units))
+	for _, unit := range units {
+		views = append(views, unit.View())
+	}
+	return views
 }
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"NemWebGoApi/api/models"
+
+	"github.com/gorilla/mux"
+)
+
+// GetUnit returns a single unit with its generation stats and its ETag, used as If-Match for updates
+// The capacity factor is taken over range.start and range.stop, default the last 7 days
+func (s *Server) GetUnit(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.queryContext(r, s.Config().GenerationQueryTimeout())
+	defer cancel()
+
+	unit, err := models.ReadUnit(ctx, s.SQLDb, mux.Vars(r)["duid"])
+	if err != nil {
+		if errors.Is(err, models.ErrUnitNotFound) {
+			s.respondUnitError(w, r, err)
+			return
+		}
+		s.respondQueryError(w, r, ctx, "Error Reading Unit:", err)
+		return
+	}
+
+	// The stats read every point of the range, so the query cannot be downsampled
+	filter := models.FilterMapToGenerationFilter(ctx, r.URL.Query())
+	if !s.enforceQueryCost(w, r, filter.Range, nil, 1, models.GenerationInterval) {
+		return
+	}
+	stats, err := models.ReadUnitStats(
+		ctx,
+		s.InfluxDB.QueryAPI(s.Config().InfluxOrg()),
+		s.Config().InfluxBucket(),
+		[]models.Unit{*unit},
+		filter.Range,
+	)
+	if err != nil {
+		s.respondQueryError(w, r, ctx, "Error Reading Unit Stats:", err)
+		return
+	}
+
+	detail := models.UnitDetail{Unit: *unit, Stats: stats[unit.DuID]}
+	w.Header().Set("ETag", unit.ETag())
+	if apiVersion(r) == apiV2 {
+		s.respondV2(w, r, detail.View(), -1, nil, http.StatusOK)
+		return
+	}
+	s.respond(w, r, detail, http.StatusOK)
+}
+
+// GetAllStations returns the stations of the units matching the unit filters
+func (s *Server) GetAllStations(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.queryContext(r, s.Config().UnitsQueryTimeout())
+	defer cancel()
+
+	stations, err := models.ReadStations(ctx, s.SQLDb, models.ParseUnitFilterMap(r.URL.Query()))
+	if err != nil {
+		s.respondQueryError(w, r, ctx, "Error Reading Stations:", err)
+		return
+	}
+
+	if apiVersion(r) == apiV2 {
+		s.respondV2(w, r, stations, len(stations), nil, http.StatusOK)
+		return
+	}
+	s.respond(w, r, stations, http.StatusOK)
+}
+
+// GetStation returns the units of a station with their generation stats and the station totals
+func (s *Server) GetStation(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := s.queryContext(r, s.Config().GenerationQueryTimeout())
+	defer cancel()
+
+	name := mux.Vars(r)["name"]
+	units, err := models.ReadStationUnits(ctx, s.SQLDb, name)
+	if err != nil {
+		s.respondQueryError(w, r, ctx, "Error Reading Station:", err)
+		return
+	}
+	if len(units) == 0 {
+		s.respond(w, r, map[string]string{"error": "station not found"}, http.StatusNotFound)
+		return
+	}
+
+	// Every member unit is read, the stats read every point of the range so cannot be downsampled
+	filter := models.FilterMapToGenerationFilter(ctx, r.URL.Query())
+	if !s.enforceQueryCost(w, r, filter.Range, nil, len(units), models.GenerationInterval) {
+		return
+	}
+	stats, err := models.ReadUnitStats(
+		ctx,
+		s.InfluxDB.QueryAPI(s.Config().InfluxOrg()),
+		s.Config().InfluxBucket(),
+		units,
+		filter.Range,
+	)
+	if err != nil {
+		s.respondQueryError(w, r, ctx, "Error Reading Station Stats:", err)
+		return
+	}
+
+	detail := models.NewStationDetail(name, units, stats)
+	if apiVersion(r) == apiV2 {
+		s.respondV2(w, r, detail.View(), -1, nil, http.StatusOK)
+		return
+	}
+	s.respond(w, r, detail, http.StatusOK)
+}
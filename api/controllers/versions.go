@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"NemWebGoApi/internal/logging"
+
+	"github.com/gorilla/mux"
+)
+
+// API versions, v1 is frozen and also served at the root, v2 wraps responses in an envelope
+const (
+	apiV1 = 1
+	apiV2 = 2
+)
+
+type apiVersionKey struct{}
+
+// withAPIVersion records the API version a route was mounted under for its handlers
+func withAPIVersion(version int) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version)))
+		})
+	}
+}
+
+// apiVersion returns the API version of the request, v1 if the route was not mounted under one
+func apiVersion(r *http.Request) int {
+	if version, ok := r.Context().Value(apiVersionKey{}).(int); ok {
+		return version
+	}
+	return apiV1
+}
+
+// respondV2 writes data in the v2 envelope, meta gains the version, request ID and,
+// for slices, the count of items
+func (s *Server) respondV2(w http.ResponseWriter, r *http.Request, data interface{}, count int, meta map[string]interface{}, status int) {
+	if meta == nil {
+		meta = make(map[string]interface{})
+	}
+	meta["version"] = apiV2
+	meta["request_id"] = logging.RequestID(r.Context())
+	if count >= 0 {
+		meta["count"] = count
+	}
+	s.respond(w, r, envelope{Data: data, Meta: meta}, status)
+}
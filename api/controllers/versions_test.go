@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"NemWebGoApi/api/models"
+	"NemWebGoApi/internal/logging"
+)
+
+// newContractServer returns a test server holding a single unit, args are as for newTestServer
+func newContractServer(t *testing.T, args ...string) *Server {
+	t.Helper()
+
+	s := newTestServer(t, args...)
+	unit := models.Unit{
+		DuID:           "BAYSW1",
+		StationName:    "Bayswater",
+		RegionID:       "NSW1",
+		FuelSource:     "Fossil",
+		TechnologyType: "Combustion",
+		MaxCapacity:    660,
+	}
+	if _, err := models.CreateUnit(context.Background(), s.SQLDb, unit, "test"); err != nil {
+		t.Fatalf("models.CreateUnit: %v", err)
+	}
+	return s
+}
+
+func get(s *Server, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func keys(m map[string]json.RawMessage) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestV1Contract pins the frozen v1 response, a bare array of units with the original field
+// names, and the deprecation headers pointing at v2
+func TestV1Contract(t *testing.T) {
+	s := newContractServer(t)
+
+	for _, path := range []string{"/units", "/v1/units"} {
+		t.Run(path, func(t *testing.T) {
+			w := get(s, path)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+			if got := w.Header().Get("Deprecation"); got != "true" {
+				t.Errorf("Deprecation = %q, want %q", got, "true")
+			}
+			if got, want := w.Header().Get("Link"), `</v2/units>; rel="successor-version"`; got != want {
+				t.Errorf("Link = %q, want %q", got, want)
+			}
+
+			var units []map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &units); err != nil {
+				t.Fatalf("body is not a JSON array: %v: %s", err, w.Body)
+			}
+			if len(units) != 1 {
+				t.Fatalf("got %d units, want 1", len(units))
+			}
+			want := []string{"duid", "fuel_source", "id", "max_capacity", "region_id", "staion_name", "technology_type"}
+			if got := keys(units[0]); !equalStrings(got, want) {
+				t.Errorf("unit fields = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestV1DeprecationLinkKeepsPath checks the successor link names the same resource under v2
+func TestV1DeprecationLinkKeepsPath(t *testing.T) {
+	s := newContractServer(t)
+
+	for path, want := range map[string]string{
+		"/units/BAYSW1/history":    `</v2/units/BAYSW1/history>; rel="successor-version"`,
+		"/v1/units/BAYSW1/history": `</v2/units/BAYSW1/history>; rel="successor-version"`,
+	} {
+		if got := get(s, path).Header().Get("Link"); got != want {
+			t.Errorf("%s: Link = %q, want %q", path, got, want)
+		}
+	}
+}
+
+// TestV2Contract pins the v2 envelope, data holds the units with corrected field names and
+// meta the version, request ID and count
+func TestV2Contract(t *testing.T) {
+	s := newContractServer(t)
+
+	w := get(s, "/v2/units")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if got := w.Header().Get("Deprecation"); got != "" {
+		t.Errorf("Deprecation = %q, want none", got)
+	}
+	if got := w.Header().Get("Link"); got != "" {
+		t.Errorf("Link = %q, want none", got)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not a JSON object: %v: %s", err, w.Body)
+	}
+	if got, want := keys(body), []string{"data", "meta"}; !equalStrings(got, want) {
+		t.Fatalf("envelope fields = %v, want %v", got, want)
+	}
+
+	var meta struct {
+		Version   int    `json:"version"`
+		RequestID string `json:"request_id"`
+		Count     *int   `json:"count"`
+	}
+	if err := json.Unmarshal(body["meta"], &meta); err != nil {
+		t.Fatalf("meta: %v", err)
+	}
+	if meta.Version != apiV2 {
+		t.Errorf("meta.version = %d, want %d", meta.Version, apiV2)
+	}
+	if meta.RequestID == "" || meta.RequestID != w.Header().Get(logging.RequestIDHeader) {
+		t.Errorf("meta.request_id = %q, want the %s header %q", meta.RequestID, logging.RequestIDHeader, w.Header().Get(logging.RequestIDHeader))
+	}
+	if meta.Count == nil || *meta.Count != 1 {
+		t.Errorf("meta.count = %v, want 1", meta.Count)
+	}
+
+	var units []map[string]json.RawMessage
+	if err := json.Unmarshal(body["data"], &units); err != nil {
+		t.Fatalf("data is not a JSON array: %v", err)
+	}
+	if len(units) != 1 {
+		t.Fatalf("got %d units, want 1", len(units))
+	}
+	want := []string{"duid", "fuel_source", "id", "latitude", "longitude", "max_capacity", "region_id", "state", "station_name", "technology_type"}
+	if got := keys(units[0]); !equalStrings(got, want) {
+		t.Errorf("unit fields = %v, want %v", got, want)
+	}
+}
+
+// TestV1Stations checks the stations routes, which predate the v1 freeze, are still served
+// at the root and under /v1 in their original shape
+func TestV1Stations(t *testing.T) {
+	s := newContractServer(t)
+
+	for _, path := range []string{"/stations", "/v1/stations"} {
+		w := get(s, path)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d: %s", path, w.Code, http.StatusOK, w.Body)
+		}
+		if got := w.Header().Get("Deprecation"); got != "true" {
+			t.Errorf("%s: Deprecation = %q, want %q", path, got, "true")
+		}
+		var stations []map[string]json.RawMessage
+		if err := json.Unmarshal(w.Body.Bytes(), &stations); err != nil {
+			t.Fatalf("%s: body is not a JSON array: %v: %s", path, err, w.Body)
+		}
+		if len(stations) != 1 {
+			t.Errorf("%s: got %d stations, want 1", path, len(stations))
+		}
+	}
+
+	w := get(s, "/v2/stations")
+	if w.Code != http.StatusOK {
+		t.Fatalf("/v2/stations: status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var body envelope
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("/v2/stations: body is not an envelope: %v: %s", err, w.Body)
+	}
+	if version, _ := body.Meta["version"].(float64); version != apiV2 {
+		t.Errorf("/v2/stations: meta.version = %v, want %d", body.Meta["version"], apiV2)
+	}
+}
+
+// TestV2OnlyEndpoints checks endpoints added after v1 was frozen are not served at the root or under /v1
+func TestV2OnlyEndpoints(t *testing.T) {
+	s := newContractServer(t)
+
+	for _, path := range []string{"/search?q=bay", "/quality"} {
+		for _, prefix := range []string{"", "/v1"} {
+			if w := get(s, prefix+path); w.Code != http.StatusNotFound {
+				t.Errorf("%s%s: status = %d, want %d", prefix, path, w.Code, http.StatusNotFound)
+			}
+		}
+	}
+
+	w := get(s, "/v2/search?q=bay")
+	if w.Code != http.StatusOK {
+		t.Fatalf("/v2/search: status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var body envelope
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("/v2/search: body is not an envelope: %v: %s", err, w.Body)
+	}
+	if version, _ := body.Meta["version"].(float64); version != apiV2 {
+		t.Errorf("/v2/search: meta.version = %v, want %d", body.Meta["version"], apiV2)
+	}
+}
@@ -1,25 +1,224 @@
 package middlewares
 
 import (
+	"encoding/json"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"NemWebGoApi/internal/auth"
+	"NemWebGoApi/internal/logging"
+	"NemWebGoApi/internal/metrics"
+	"NemWebGoApi/internal/ratelimit"
+	"NemWebGoApi/internal/tracing"
+
+	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// LoggingMW logs resuts made to the server
-// Address Request, Method, URL
-func LoggingMW(next http.Handler) http.Handler {
+// RequestIDMW attaches a request ID to the request context and response headers,
+// reusing the client's X-Request-ID if it is valid
+func RequestIDMW(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Debugf("%s \t %s \t %s", r.RemoteAddr, r.Method, r.RequestURI)
-		next.ServeHTTP(w, r)
+		id := r.Header.Get(logging.RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(logging.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
 	})
 }
 
-func TimingMW(next http.Handler) http.Handler {
+// AccessLogMW logs one line per request with the method, route template, status,
+// bytes written, duration and client, must run after RequestIDMW
+// X-Forwarded-For is only used for the client IP when trustProxy is set
+func AccessLogMW(trustProxy bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			startTime := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			logging.FromContext(r.Context()).WithFields(log.Fields{
+				"method":      r.Method,
+				"route":       routeTemplate(r),
+				"path":        r.URL.RequestURI(),
+				"status":      rec.statusCode(),
+				"bytes":       rec.bytes,
+				"duration_ms": float64(time.Since(startTime).Microseconds()) / 1000,
+				"client":      ClientIP(r, trustProxy),
+			}).Infoln("request")
+		})
+	}
+}
+
+// statusRecorder captures the status code and bytes written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// statusCode returns the recorded status, handlers that never write default to 200
+func (r *statusRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// routeTemplate returns the matched mux route template so metrics are not labelled per URL
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return "unmatched"
+}
+
+// MetricsMW records request counts and latency by route template, method and status
+func MetricsMW(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		startTime := time.Now()
-		next.ServeHTTP(w, r)
-		log.Traceln("Execution Time:", time.Since(startTime))
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		route := routeTemplate(r)
+		status := strconv.Itoa(rec.statusCode())
+		metrics.HTTPRequests.Inc(route, r.Method, status)
+		metrics.HTTPRequestDuration.Observe(time.Since(startTime).Seconds(), route, r.Method, status)
+	})
+}
+
+// TracingMW starts a server span per request named by route template,
+// continuing any trace propagated by the client in the traceparent header
+func TracingMW(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(
+			ctx,
+			r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(r.Method),
+				semconv.HTTPRouteKey.String(route),
+				semconv.HTTPTargetKey.String(r.URL.RequestURI()),
+				attribute.String("http.request_id", logging.RequestID(r.Context())),
+			),
+		)
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(rec.statusCode())...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(rec.statusCode(), trace.SpanKindServer))
 	})
 }
+
+// AuditMW logs which API key made each authenticated request,
+// must run after the principal has been attached to the request context
+// X-Forwarded-For is only used for the client IP when trustProxy is set
+func AuditMW(trustProxy bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := auth.FromContext(r.Context())
+			if principal == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			logging.FromContext(r.Context()).WithFields(log.Fields{
+				"audit":    true,
+				"key_id":   principal.KeyID,
+				"key_name": principal.Name,
+				"client":   ClientIP(r, trustProxy),
+				"method":   r.Method,
+				"path":     r.URL.RequestURI(),
+				"status":   rec.statusCode(),
+			}).Infoln("API request")
+		})
+	}
+}
+
+// RateLimitMW limits requests per API key, or per client IP for anonymous requests,
+// responding 429 with a Retry-After header once the client's bucket is empty
+// X-Forwarded-For is only used for the client IP when trustProxy is set
+func RateLimitMW(limiter *ratelimit.Limiter, trustProxy bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := "ip:" + ClientIP(r, trustProxy)
+			if principal := auth.FromContext(r.Context()); principal != nil {
+				key = "key:" + strconv.FormatInt(principal.KeyID, 10)
+			}
+
+			ok, remaining, retryAfter := limiter.Allow(key)
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limiter.Limit()))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			if !ok {
+				seconds := int(retryAfter.Seconds()) + 1
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"error":       "rate limit exceeded",
+					"retry_after": seconds,
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the address of the client, the first X-Forwarded-For entry if trustProxy is set
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// DeprecationMW marks responses as deprecated with a Link to their successor, the request
+// path with prefix replaced by successor
+func DeprecationMW(prefix string, successor string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "<"+successor+strings.TrimPrefix(r.URL.Path, prefix)+">; rel=\"successor-version\"")
+			next.ServeHTTP(w, r)
+		})
+	}
+}
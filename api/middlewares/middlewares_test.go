@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"NemWebGoApi/internal/auth"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestAuditMWClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		want       string
+	}{
+		{"direct", false, "192.0.2.10"},
+		{"behind a proxy", true, "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := test.NewLocal(log.StandardLogger())
+			defer hook.Reset()
+
+			handler := AuditMW(tt.trustProxy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			r := httptest.NewRequest(http.MethodGet, "/v2/units", nil)
+			r.RemoteAddr = "192.0.2.10:52100"
+			r.Header.Set("X-Forwarded-For", "203.0.113.7, 192.0.2.10")
+			r = r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{KeyID: 1, Name: "test"}))
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			entry := hook.LastEntry()
+			if entry == nil {
+				t.Fatal("no audit entry logged")
+			}
+			if got := entry.Data["client"]; got != tt.want {
+				t.Errorf("client = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"NemWebGoApi/internal/auth"
+	"NemWebGoApi/internal/metrics"
+)
+
+// APIKey is the structure of the api_keys table, only the hash of the key is stored
+type APIKey struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// ErrAPIKeyNotFound is returned when a key does not exist or has been revoked
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// keyDisplayPrefix is how many characters of the key are kept to identify it in listings
+const keyDisplayPrefix = 12
+
+// CreateAPIKey issues a new key with the given scopes, returning the stored key
+// and the plaintext which is not recoverable afterwards
+func CreateAPIKey(ctx context.Context, db *sql.DB, name string, scopes []string) (*APIKey, string, error) {
+	for _, scope := range scopes {
+		if !auth.ValidScope(scope) {
+			return nil, "", fmt.Errorf("models.CreateAPIKey: invalid scope %q", scope)
+		}
+	}
+
+	plaintext, err := auth.GenerateKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("models.CreateAPIKey: %w", err)
+	}
+
+	key := &APIKey{
+		Name:      name,
+		Prefix:    plaintext[:keyDisplayPrefix],
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	query := "INSERT INTO api_keys (name, prefix, key_hash, scopes, created_at) VALUES (?, ?, ?, ?, ?)"
+	ctx, done := startQuery(ctx, metrics.StoreSQLite, "api_keys", query)
+	res, err := db.ExecContext(ctx, query, key.Name, key.Prefix, auth.HashKey(plaintext), strings.Join(scopes, ","), key.CreatedAt)
+	done(1, err)
+	if err != nil {
+		return nil, "", fmt.Errorf("models.CreateAPIKey: exec error: %w", err)
+	}
+
+	key.ID, err = res.LastInsertId()
+	if err != nil {
+		return nil, "", fmt.Errorf("models.CreateAPIKey: insert id error: %w", err)
+	}
+	return key, plaintext, nil
+}
+
+// FindAPIKey returns the active key matching the plaintext
+func FindAPIKey(ctx context.Context, db *sql.DB, plaintext string) (*APIKey, error) {
+	query := "SELECT id, name, prefix, scopes, created_at, revoked_at FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL"
+	ctx, done := startQuery(ctx, metrics.StoreSQLite, "api_keys", query)
+	key, err := scanAPIKey(db.QueryRowContext(ctx, query, auth.HashKey(plaintext)))
+	if err == sql.ErrNoRows {
+		done(0, nil)
+		return nil, ErrAPIKeyNotFound
+	}
+	done(1, err)
+	if err != nil {
+		return nil, fmt.Errorf("models.FindAPIKey: query error: %w", err)
+	}
+	return key, nil
+}
+
+// ReadAllAPIKeys returns every key, including revoked keys
+func ReadAllAPIKeys(ctx context.Context, db *sql.DB) ([]APIKey, error) {
+	query := "SELECT id, name, prefix, scopes, created_at, revoked_at FROM api_keys ORDER BY id"
+	ctx, done := startQuery(ctx, metrics.StoreSQLite, "api_keys", query)
+	results, err := db.QueryContext(ctx, query)
+	if err != nil {
+		done(0, err)
+		return []APIKey{}, fmt.Errorf("models.ReadAllAPIKeys: query error: %w", err)
+	}
+	defer results.Close()
+
+	keys := make([]APIKey, 0)
+	for results.Next() {
+		key, err := scanAPIKey(results)
+		if err != nil {
+			done(0, err)
+			return []APIKey{}, fmt.Errorf("models.ReadAllAPIKeys: scan error: %w", err)
+		}
+		keys = append(keys, *key)
+	}
+	if err := results.Err(); err != nil {
+		done(0, err)
+		return []APIKey{}, fmt.Errorf("models.ReadAllAPIKeys: query parsing error: %w", err)
+	}
+	done(len(keys), nil)
+	return keys, nil
+}
+
+// RevokeAPIKey marks a key as revoked so it can no longer authenticate
+func RevokeAPIKey(ctx context.Context, db *sql.DB, id int64) error {
+	query := "UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL"
+	ctx, done := startQuery(ctx, metrics.StoreSQLite, "api_keys", query)
+	res, err := db.ExecContext(ctx, query, time.Now().UTC(), id)
+	done(1, err)
+	if err != nil {
+		return fmt.Errorf("models.RevokeAPIKey: exec error: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var key APIKey
+	var scopes string
+	var revokedAt sql.NullTime
+	if err := row.Scan(&key.ID, &key.Name, &key.Prefix, &scopes, &key.CreatedAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	key.Scopes = strings.Split(scopes, ",")
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return &key, nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"NemWebGoApi/internal/metrics"
+)
+
+// Statuses of a backfill checkpoint
+const (
+	BackfillDone   = "done"
+	BackfillFailed = "failed"
+)
+
+// BackfillCheckpoint is the structure of the backfill_checkpoints table, the outcome of
+// the last backfill of an archive
+type BackfillCheckpoint struct {
+	Path       string
+	Size       int64
+	ModifiedAt time.Time
+	Status     string
+	Points     int
+	Duplicates int
+	Error      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Matches returns true if the checkpoint is for the file as it is now
+func (c *BackfillCheckpoint) Matches(size int64, modifiedAt time.Time) bool {
+	return c.Size == size && c.ModifiedAt.Equal(modifiedAt)
+}
+
+// ReadBackfillCheckpoints returns the checkpoints keyed by path
+func ReadBackfillCheckpoints(ctx context.Context, db *sql.DB) (map[string]BackfillCheckpoint, error) {
+	query := "SELECT path, size, modified_at, status, points, duplicates, error, started_at, finished_at FROM backfill_checkpoints"
+	ctx, done := startQuery(ctx, metrics.StoreSQLite, "backfill_checkpoints", query)
+	results, err := db.QueryContext(ctx, query)
+	if err != nil {
+		done(0, err)
+		return nil, fmt.Errorf("models.ReadBackfillCheckpoints: query error: %w", err)
+	}
+	defer results.Close()
+
+	checkpoints := make(map[string]BackfillCheckpoint)
+	for results.Next() {
+		var c BackfillCheckpoint
+		var errText sql.NullString
+		if err := results.Scan(&c.Path, &c.Size, &c.ModifiedAt, &c.Status, &c.Points, &c.Duplicates, &errText, &c.StartedAt, &c.FinishedAt); err != nil {
+			done(0, err)
+			return nil, fmt.Errorf("models.ReadBackfillCheckpoints: scan error: %w", err)
+		}
+		c.Error = errText.String
+		checkpoints[c.Path] = c
+	}
+	if err := results.Err(); err != nil {
+		done(0, err)
+		return nil, fmt.Errorf("models.ReadBackfillCheckpoints: query parsing error: %w", err)
+	}
+	done(len(checkpoints), nil)
+	return checkpoints, nil
+}
+
+// SaveBackfillCheckpoint records the outcome of backfilling an archive, replacing any earlier one
+func SaveBackfillCheckpoint(ctx context.Context, db *sql.DB, c BackfillCheckpoint) error {
+	query := `INSERT INTO backfill_checkpoints (path, size, modified_at, status, points, duplicates, error, started_at, finished_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (path) DO UPDATE SET size = excluded.size, modified_at = excluded.modified_at, status = excluded.status,
+	points = excluded.points, duplicates = excluded.duplicates, error = excluded.error,
+	started_at = excluded.started_at, finished_at = excluded.finished_at`
+	ctx, done := startQuery(ctx, metrics.StoreSQLite, "backfill_checkpoints", query)
+	_, err := db.ExecContext(ctx, query, c.Path, c.Size, c.ModifiedAt.UTC(), c.Status, c.Points, c.Duplicates,
+		nullString(c.Error), c.StartedAt.UTC(), c.FinishedAt.UTC())
+	done(1, err)
+	if err != nil {
+		return fmt.Errorf("models.SaveBackfillCheckpoint: exec error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Native reporting intervals of each measurement, used when a query is not aggregated
+const (
+	DemandInterval     = 5 * time.Minute
+	RooftopInterval    = 30 * time.Minute
+	GenerationInterval = 5 * time.Minute
+)
+
+// NEMRegionCount is the number of NEM regions, used as the series count when no region filter is given
+const NEMRegionCount = 5
+
+// downsampleWindows are the aggregation windows tried, smallest first, when downsampling a query
+var downsampleWindows = []string{"5m", "10m", "15m", "30m", "1h", "2h", "3h", "6h", "12h", "1d", "7d", "30d"}
+
+var fluxDurationPart = regexp.MustCompile(`(\d+)(ns|us|ms|mo|s|m|h|d|w|y)`)
+
+// QueryCost is an estimate of the points a time series query will read
+type QueryCost struct {
+	Series int
+	Range  time.Duration
+	Window time.Duration
+	Points int64
+}
+
+// EstimateCost estimates the points read for series time series over the range,
+// at the aggregate window if one is set or the measurement's native interval otherwise
+func EstimateCost(rng RangeFilter, agg AggregateFilter, series int, nativeInterval time.Duration) QueryCost {
+	cost := QueryCost{
+		Series: series,
+		Range:  rng.duration(time.Now()),
+		Window: nativeInterval,
+	}
+	if window, ok := agg.window(); ok && window > nativeInterval {
+		cost.Window = window
+	}
+	if cost.Window > 0 {
+		cost.Points = int64(series) * int64(cost.Range/cost.Window)
+	}
+	return cost
+}
+
+// Downsample sets the smallest aggregate window that brings cost within budget,
+// keeping the aggregate function if one was given and using mean otherwise
+// Returns the window chosen, false if no window is large enough
+func (f *AggregateFilter) Downsample(cost QueryCost, budget int64) (string, bool) {
+	for _, every := range downsampleWindows {
+		window, _ := parseFluxDuration(every)
+		if window <= cost.Window {
+			continue
+		}
+		if int64(cost.Series)*int64(cost.Range/window) <= budget {
+			f.every = every
+			if !validAggregateFn(f.fn) {
+				f.fn = "mean"
+			}
+			return every, true
+		}
+	}
+	return "", false
+}
+
+// window returns the aggregate window if the filter will be applied to the query
+func (f *AggregateFilter) window() (time.Duration, bool) {
+	if !validAggregateFn(f.fn) {
+		return 0, false
+	}
+	return parseFluxDuration(f.every)
+}
+
+// duration returns the length of the range, mirroring the defaults of buildRangeFilterFluxStatement
+func (f *RangeFilter) duration(now time.Time) time.Duration {
+	start, stop := f.bounds(now)
+	if stop.Before(start) {
+		return 0
+	}
+	return stop.Sub(start)
+}
+
+// bounds returns the start and stop of the range, mirroring the defaults of buildRangeFilterFluxStatement
+func (f *RangeFilter) bounds(now time.Time) (time.Time, time.Time) {
+	start, ok := parseFluxTime(f.start, now)
+	if !ok {
+		start = now.Add(-7 * 24 * time.Hour)
+	}
+	stop, ok := parseFluxTime(f.stop, now)
+	if !ok {
+		stop = now
+	}
+	return start, stop
+}
+
+func validAggregateFn(fn string) bool {
+	for _, v := range aggregateFunctions {
+		if v == fn {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFluxDuration parses a Flux duration literal such as 1h30m or -7d,
+// months and years are approximated as 30 and 365 days
+func parseFluxDuration(s string) (time.Duration, bool) {
+	if !validFluxDuration(s) {
+		return 0, false
+	}
+
+	sign := time.Duration(1)
+	if s[0] == '-' {
+		sign = -1
+	}
+
+	var d time.Duration
+	for _, part := range fluxDurationPart.FindAllStringSubmatch(s, -1) {
+		n, err := strconv.ParseInt(part[1], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		var unit time.Duration
+		switch part[2] {
+		case "ns":
+			unit = time.Nanosecond
+		case "us":
+			unit = time.Microsecond
+		case "ms":
+			unit = time.Millisecond
+		case "s":
+			unit = time.Second
+		case "m":
+			unit = time.Minute
+		case "h":
+			unit = time.Hour
+		case "d":
+			unit = 24 * time.Hour
+		case "w":
+			unit = 7 * 24 * time.Hour
+		case "mo":
+			unit = 30 * 24 * time.Hour
+		case "y":
+			unit = 365 * 24 * time.Hour
+		}
+		d += time.Duration(n) * unit
+	}
+	return sign * d, true
+}
+
+// parseFluxTime parses a range bound given as a relative duration, unix seconds or ISO time
+func parseFluxTime(s string, now time.Time) (time.Time, bool) {
+	switch {
+	case validFluxDuration(s):
+		d, ok := parseFluxDuration(s)
+		return now.Add(d), ok
+	case validUnixTime(s):
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(n, 0), true
+	case validISOTime(s):
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// String explains the estimate, e.g. "3 series over 168h0m0s at 5m0s = 6048 points"
+func (c QueryCost) String() string {
+	return fmt.Sprintf("%d series over %s at %s = %d points", c.Series, c.Range, c.Window, c.Points)
+}
@@ -5,12 +5,28 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"NemWebGoApi/internal/logging"
+	"NemWebGoApi/internal/metrics"
+	"NemWebGoApi/internal/tracing"
+
 	"github.com/influxdata/influxdb-client-go/v2/api"
-	log "github.com/sirupsen/logrus"
 )
 
+// ErrNoMatchingUnits is returned when unit filters match no units
+var ErrNoMatchingUnits = errors.New("no units match the filters")
+
+// MaxGroupsPerQuery limits the groups, e.g. stations, summed by one grouped generation query,
+// each group is a sub-query of its own
+const MaxGroupsPerQuery = 100
+
+// ErrTooManyGroups is returned when a grouped generation query covers more than MaxGroupsPerQuery groups
+var ErrTooManyGroups = errors.New("too many groups")
+
 type DemandDataPoint struct {
 	Time     time.Time `json:"time"`
 	RegionID string    `json:"region_id"`
@@ -37,12 +53,14 @@ type DemandFilter struct {
 	Range     RangeFilter     `col:"range"` // col is unused for range but required for parsing
 	RegionID  StringFilter    `col:"regionId"`
 	Aggregate AggregateFilter `col:"aggregate"` // col is unused for aggregate but required for parsing
+	Fill      FillFilter
 }
 
 type RooftopFilter struct {
 	Range     RangeFilter     `col:"range"` // col is unused for range but required for parsing
 	RegionID  StringFilter    `col:"regionId"`
 	Aggregate AggregateFilter `col:"aggregate"` // col is unused for aggregate but required for parsing
+	Fill      FillFilter
 }
 
 type GeneratorFilter struct {
@@ -52,6 +70,7 @@ type GeneratorFilter struct {
 	RegionID       StringFilter    `col:"region_id"`
 	FuelSource     StringFilter    `col:"fuel_source"`
 	TechnologyType StringFilter    `col:"technology_type"`
+	Fill           FillFilter
 }
 
 type GeneratorGroupedFilter struct {
@@ -61,20 +80,24 @@ type GeneratorGroupedFilter struct {
 	RegionID       StringFilter    `col:"region_id"`
 	FuelSource     StringFilter    `col:"fuel_source"`
 	TechnologyType StringFilter    `col:"technology_type"`
+	Fill           FillFilter
 }
 
-func ReadDemandData(db api.QueryAPI, bucket string, filter DemandFilter) ([]DemandDataPoint, error) {
+func ReadDemandData(ctx context.Context, db api.QueryAPI, bucket string, filter DemandFilter) ([]DemandDataPoint, error) {
 	points := make([]DemandDataPoint, 0)
 
 	fluxQuery := fmt.Sprintf("from(bucket: \"%s\")", bucket)
-	fluxQuery += buildFluxQuery(filter)
+	fluxQuery += buildFluxQuery(ctx, filter)
 	fluxQuery += "\n\t|> filter(fn: (r) => r._measurement == \"demand\")"
 
-	result, err := db.Query(context.Background(), fluxQuery)
+	ctx, done := startQuery(ctx, metrics.StoreInflux, "demand", fluxQuery)
+	result, err := db.Query(ctx, fluxQuery)
 
 	if err != nil {
-		return []DemandDataPoint{}, fmt.Errorf("models.ReadDemandData: query error: %v", err)
+		done(0, err)
+		return []DemandDataPoint{}, fmt.Errorf("models.ReadDemandData: query error: %w", err)
 	}
+	defer result.Close()
 
 	for result.Next() {
 		value, _ := getFloatReflectOnly(result.Record().Value())
@@ -87,24 +110,29 @@ func ReadDemandData(db api.QueryAPI, bucket string, filter DemandFilter) ([]Dema
 	}
 
 	if result.Err() != nil {
-		return []DemandDataPoint{}, fmt.Errorf("models.ReadDemandData: query parsing error: %v", result.Err())
+		done(0, result.Err())
+		return []DemandDataPoint{}, fmt.Errorf("models.ReadDemandData: query parsing error: %w", result.Err())
 	}
 
-	return points, nil
+	done(len(points), nil)
+	return filter.Fill.fillDemand(points, filter.Fill.times(filter.Range, filter.Aggregate, DemandInterval, time.Now())), nil
 }
 
-func ReadRooftapData(db api.QueryAPI, bucket string, filter RooftopFilter) ([]RooftopDataPoint, error) {
+func ReadRooftapData(ctx context.Context, db api.QueryAPI, bucket string, filter RooftopFilter) ([]RooftopDataPoint, error) {
 	points := make([]RooftopDataPoint, 0)
 
 	fluxQuery := fmt.Sprintf("from(bucket: \"%s\")", bucket)
-	fluxQuery += buildFluxQuery(filter)
+	fluxQuery += buildFluxQuery(ctx, filter)
 	fluxQuery += "\n\t|> filter(fn: (r) => r._measurement == \"rooftop\")"
 
-	result, err := db.Query(context.Background(), fluxQuery)
+	ctx, done := startQuery(ctx, metrics.StoreInflux, "rooftop", fluxQuery)
+	result, err := db.Query(ctx, fluxQuery)
 
 	if err != nil {
-		return []RooftopDataPoint{}, fmt.Errorf("models.ReadRooftapData: query error: %v", err)
+		done(0, err)
+		return []RooftopDataPoint{}, fmt.Errorf("models.ReadRooftapData: query error: %w", err)
 	}
+	defer result.Close()
 
 	for result.Next() {
 		value, _ := getFloatReflectOnly(result.Record().Value())
@@ -117,29 +145,36 @@ func ReadRooftapData(db api.QueryAPI, bucket string, filter RooftopFilter) ([]Ro
 	}
 
 	if result.Err() != nil {
-		return []RooftopDataPoint{}, fmt.Errorf("models.ReadRooftapData: query parsing error: %v", result.Err())
+		done(0, result.Err())
+		return []RooftopDataPoint{}, fmt.Errorf("models.ReadRooftapData: query parsing error: %w", result.Err())
 	}
 
-	return points, nil
+	done(len(points), nil)
+	return filter.Fill.fillRooftop(points, filter.Fill.times(filter.Range, filter.Aggregate, RooftopInterval, time.Now())), nil
 }
 
-func ReadGenerationData(db api.QueryAPI, bucket string, filter GeneratorFilter) ([]GenerationDataPoint, error) {
+func ReadGenerationData(ctx context.Context, db api.QueryAPI, bucket string, filter GeneratorFilter) ([]GenerationDataPoint, error) {
 	data := make([]GenerationDataPoint, 0)
 
 	fluxQuery := fmt.Sprintf("from(bucket: \"%s\")", bucket)
-	fluxQuery += buildFluxQuery(filter)
+	fluxQuery += buildFluxQuery(ctx, filter)
 	fluxQuery += "\n\t|> filter(fn: (r) => r._measurement == \"generation\")"
 
-	result, err := db.Query(context.Background(), fluxQuery)
+	ctx, done := startQuery(ctx, metrics.StoreInflux, "generation", fluxQuery)
+	result, err := db.Query(ctx, fluxQuery)
 
 	if err != nil {
-		return []GenerationDataPoint{}, fmt.Errorf("models.ReadGenerationData: query error: %v", err)
+		done(0, err)
+		return []GenerationDataPoint{}, fmt.Errorf("models.ReadGenerationData: query error: %w", err)
 	}
+	defer result.Close()
 
 	var units []string
 	unitMap := make(map[string][]DataPoint)
 
+	rows := 0
 	for result.Next() {
+		rows++
 		value, _ := getFloatReflectOnly(result.Record().Value())
 		unitName := fmt.Sprintf("%v", result.Record().ValueByKey("unit"))
 
@@ -158,7 +193,8 @@ func ReadGenerationData(db api.QueryAPI, bucket string, filter GeneratorFilter)
 	}
 
 	if result.Err() != nil {
-		return []GenerationDataPoint{}, fmt.Errorf("models.ReadGenerationData: query parsing error: %v", result.Err())
+		done(0, result.Err())
+		return []GenerationDataPoint{}, fmt.Errorf("models.ReadGenerationData: query parsing error: %w", result.Err())
 	}
 
 	for _, v := range units {
@@ -168,17 +204,28 @@ func ReadGenerationData(db api.QueryAPI, bucket string, filter GeneratorFilter)
 		})
 	}
 
-	return data, nil
+	done(rows, nil)
+	return filter.Fill.fillSeries(data, filter.Fill.times(filter.Range, filter.Aggregate, GenerationInterval, time.Now())), nil
 }
 
-func ReadGroupedGenerationData(db api.QueryAPI, bucket string, baseFilter GeneratorGroupedFilter, groups map[string][]Unit) ([]GenerationDataPoint, error) {
-	fluxQuery := ""
+func ReadGroupedGenerationData(ctx context.Context, db api.QueryAPI, bucket string, baseFilter GeneratorGroupedFilter, groups map[string][]Unit) ([]GenerationDataPoint, error) {
+	names := make([]string, 0, len(groups))
 	for name, group := range groups {
-		if len(group) == 0 {
-			continue
+		if len(group) != 0 {
+			names = append(names, name)
 		}
+	}
+	if len(names) > MaxGroupsPerQuery {
+		return []GenerationDataPoint{}, fmt.Errorf("models.ReadGroupedGenerationData: %w: %d groups, at most %d", ErrTooManyGroups, len(names), MaxGroupsPerQuery)
+	}
+	sort.Strings(names)
+
+	// Results are yielded by index as group names, e.g. station names, may not be valid in a Flux string
+	fluxQuery := ""
+	for index, name := range names {
+		group := groups[name]
 		newQuery := fmt.Sprintf("from(bucket: \"%s\")", bucket)
-		newQuery += buildFluxQuery(baseFilter)
+		newQuery += buildFluxQuery(ctx, baseFilter)
 		newQuery += "\n\t|> filter(fn: (r) => r._measurement == \"generation\")"
 		newQuery += "\n\t|> filter(fn: (r) => r[\"unit\"] == "
 		i := 0
@@ -186,14 +233,14 @@ func ReadGroupedGenerationData(db api.QueryAPI, bucket string, baseFilter Genera
 			if i > 0 {
 				newQuery += fmt.Sprintf(" or r[\"unit\"] == ")
 			}
-			newQuery += fmt.Sprintf("\"%s\"", unit.DuID)
+			newQuery += fluxString(unit.DuID)
 			i++
 		}
 		newQuery += ")"
 		newQuery += "\n\t|> group(columns: [\"_time\", \"_measurement\"])"
 		newQuery += "\n\t|> sum(column: \"_value\")"
 		newQuery += "\n\t|> group(columns: [\"_measurement\"])"
-		newQuery += fmt.Sprintf("\n\t|> yield(name: \"%s\")", name)
+		newQuery += fmt.Sprintf("\n\t|> yield(name: \"%d\")", index)
 		fluxQuery += newQuery + "\n"
 	}
 
@@ -201,21 +248,33 @@ func ReadGroupedGenerationData(db api.QueryAPI, bucket string, baseFilter Genera
 		return []GenerationDataPoint{}, fmt.Errorf("models.ReadGroupedGenerationData: query error: flux query empty, no groups")
 	}
 
-	log.Traceln(fluxQuery)
+	logging.FromContext(ctx).Traceln(fluxQuery)
 
-	result, err := db.Query(context.Background(), fluxQuery)
+	ctx, done := startQuery(ctx, metrics.StoreInflux, "generation", fluxQuery)
+	result, err := db.Query(ctx, fluxQuery)
 
 	if err != nil {
-		return []GenerationDataPoint{}, fmt.Errorf("models.ReadGroupedGenerationData: query error: %v", err)
+		done(0, err)
+		return []GenerationDataPoint{}, fmt.Errorf("models.ReadGroupedGenerationData: query error: %w", err)
 	}
+	defer result.Close()
 
 	var units []string
 	data := make([]GenerationDataPoint, 0)
 	unitMap := make(map[string][]DataPoint)
 
+	rows := 0
 	for result.Next() {
+		rows++
 		value, _ := getFloatReflectOnly(result.Record().Value())
-		unitName := result.TableMetadata().Column(0).DefaultValue()
+		yield := result.TableMetadata().Column(0).DefaultValue()
+		index, err := strconv.Atoi(yield)
+		if err != nil || index < 0 || index >= len(names) {
+			err = fmt.Errorf("unknown result %q", yield)
+			done(0, err)
+			return []GenerationDataPoint{}, fmt.Errorf("models.ReadGroupedGenerationData: query parsing error: %w", err)
+		}
+		unitName := names[index]
 
 		if _, ok := unitMap[unitName]; ok {
 			unitMap[unitName] = append(unitMap[unitName], DataPoint{
@@ -232,7 +291,8 @@ func ReadGroupedGenerationData(db api.QueryAPI, bucket string, baseFilter Genera
 	}
 
 	if result.Err() != nil {
-		return []GenerationDataPoint{}, fmt.Errorf("models.ReadGroupedGenerationData: query parsing error: %v", result.Err())
+		done(0, result.Err())
+		return []GenerationDataPoint{}, fmt.Errorf("models.ReadGroupedGenerationData: query parsing error: %w", result.Err())
 	}
 
 	for _, v := range units {
@@ -242,54 +302,109 @@ func ReadGroupedGenerationData(db api.QueryAPI, bucket string, baseFilter Genera
 		})
 	}
 
-	return data, nil
+	done(rows, nil)
+	return baseFilter.Fill.fillSeries(data, baseFilter.Fill.times(baseFilter.Range, baseFilter.Aggregate, GenerationInterval, time.Now())), nil
+}
+
+// fluxString quotes s as a Flux string literal, escaping quotes, backslashes and interpolation
+func fluxString(s string) string {
+	return `"` + fluxStringEscaper.Replace(s) + `"`
 }
 
-func FilterMaptoDemandFilter(filterMap map[string][]string) DemandFilter {
+var fluxStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `${`, `\${`)
+
+func FilterMaptoDemandFilter(ctx context.Context, filterMap map[string][]string) DemandFilter {
 	var filter DemandFilter
-	log.Debugln(filterMap)
+	logging.FromContext(ctx).Debugln(filterMap)
 
 	filter.Range.fromFilterMap(filterMap, "range")
 	filter.RegionID.fromFilterMap(filterMap, "region_id")
 	filter.Aggregate.fromFilterMap(filterMap, "aggregate")
 
+	filter.Fill.fromFilterMap(filterMap, "fill")
+	filter.Fill.validate(filter.Aggregate)
+
 	return filter
 }
 
-func FilterMaptoRooftopFilter(filterMap map[string][]string) RooftopFilter {
+func FilterMaptoRooftopFilter(ctx context.Context, filterMap map[string][]string) RooftopFilter {
 	var filter RooftopFilter
-	log.Debugln(filterMap)
+	logging.FromContext(ctx).Debugln(filterMap)
 
 	filter.Range.fromFilterMap(filterMap, "range")
 	filter.RegionID.fromFilterMap(filterMap, "region_id")
 	filter.Aggregate.fromFilterMap(filterMap, "aggregate")
 
+	filter.Fill.fromFilterMap(filterMap, "fill")
+	filter.Fill.validate(filter.Aggregate)
+
 	return filter
 }
 
-func FilterMapToGenerationFilter(filterMap map[string][]string) GeneratorFilter {
+func FilterMapToGenerationFilter(ctx context.Context, filterMap map[string][]string) GeneratorFilter {
 	var filter GeneratorFilter
-	log.Debugln(filterMap)
+	logging.FromContext(ctx).Debugln(filterMap)
 
 	filter.Range.fromFilterMap(filterMap, "range")
 	filter.DuID.fromFilterMap(filterMap, "duid")
 	filter.Aggregate.fromFilterMap(filterMap, "aggregate")
 
+	filter.Fill.fromFilterMap(filterMap, "fill")
+	filter.Fill.validate(filter.Aggregate)
+
 	return filter
 }
 
-func FilterMapToGenerationGroupedFilter(filterMap map[string][]string) GeneratorGroupedFilter {
+// ResolveUnits fills the DUID filter from the unit filters in filterMap when no DUIDs were given
+// TODO: Think of better method to filter, very confusing already caught me out twice
+// Currently if there are no DUID filters given it will then search
+// ErrNoMatchingUnits is returned when the unit filters match no units, as the generation
+// query would otherwise be unfiltered and return every unit
+func (f *GeneratorFilter) ResolveUnits(ctx context.Context, db *sql.DB, filterMap map[string][]string) error {
+	if len(f.DuID.GetEq()) != 0 {
+		return nil
+	}
+
+	unitFilter := ParseUnitFilterMap(filterMap)
+	if err := unitFilter.Location.Err(); err != nil {
+		return err
+	}
+	unit := Unit{}
+	units, err := unit.ReadAll(ctx, db, unitFilter)
+	if err != nil {
+		return err
+	}
+	if len(*units) == 0 {
+		return ErrNoMatchingUnits
+	}
+
+	duids := []string{}
+	for _, val := range *units {
+		duids = append(duids, val.DuID)
+	}
+
+	duids = append(duids, f.DuID.GetEq()[:]...)
+	f.DuID.SetEq(duids)
+	return nil
+}
+
+func FilterMapToGenerationGroupedFilter(ctx context.Context, filterMap map[string][]string) GeneratorGroupedFilter {
 	var filter GeneratorGroupedFilter
-	log.Debugln(filterMap)
+	logging.FromContext(ctx).Debugln(filterMap)
 
 	filter.Range.fromFilterMap(filterMap, "range")
 	filter.Group.fromFilterMap(filterMap, "group")
 	filter.Aggregate.fromFilterMap(filterMap, "aggregate")
 
+	filter.Fill.fromFilterMap(filterMap, "fill")
+	filter.Fill.validate(filter.Aggregate)
+
 	return filter
 }
 
-func (g *GeneratorGroupedFilter) GetAllGroupUnitCombinations(db *sql.DB, queryFilter map[string][]string) (map[string][]Unit, map[string]UnitFilter, error) {
+func (g *GeneratorGroupedFilter) GetAllGroupUnitCombinations(ctx context.Context, db *sql.DB, queryFilter map[string][]string) (map[string][]Unit, map[string]UnitFilter, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "models.GetAllGroupUnitCombinations")
+	defer span.End()
 
 	if len(g.Group.GetEq()) == 0 {
 		return nil, nil, errors.New(fmt.Sprintf("error getAllGroupUnitCombinations: no groups given"))
@@ -303,9 +418,9 @@ func (g *GeneratorGroupedFilter) GetAllGroupUnitCombinations(db *sql.DB, queryFi
 
 	baseFilter := ParseUnitFilterMap(queryFilter)
 
-	allUnits, err := unit.ReadAll(db, baseFilter)
+	allUnits, err := unit.ReadAll(ctx, db, baseFilter)
 	if err != nil {
-		return nil, nil, errors.New(fmt.Sprintf("error retrieving units: %v", err))
+		return nil, nil, fmt.Errorf("error retrieving units: %w", err)
 	}
 
 	for _, group := range g.Group.GetEq() {
@@ -317,9 +432,9 @@ func (g *GeneratorGroupedFilter) GetAllGroupUnitCombinations(db *sql.DB, queryFi
 		// Need to Create a New Filter for Each Region to append to the already existing filters
 		switch group {
 		case "region":
-			regions, err := GetUniqueRegions(db)
+			regions, err := GetUniqueRegions(ctx, db)
 			if err != nil {
-				return nil, nil, errors.New(fmt.Sprintf("error retrieving unique regions: %v", err))
+				return nil, nil, fmt.Errorf("error retrieving unique regions: %w", err)
 			}
 			if len(groupedUnits) > 0 && len(groupedFilters) > 0 {
 				newFilters := make(map[string]UnitFilter)
@@ -368,9 +483,9 @@ func (g *GeneratorGroupedFilter) GetAllGroupUnitCombinations(db *sql.DB, queryFi
 				}
 			}
 		case "fuel":
-			fuels, err := GetUniqueFuels(db)
+			fuels, err := GetUniqueFuels(ctx, db)
 			if err != nil {
-				return nil, nil, errors.New(fmt.Sprintf("error retrieving unique fuels: %v", err))
+				return nil, nil, fmt.Errorf("error retrieving unique fuels: %w", err)
 			}
 			if len(groupedUnits) > 0 && len(groupedFilters) > 0 {
 				newFilters := make(map[string]UnitFilter)
@@ -419,9 +534,9 @@ func (g *GeneratorGroupedFilter) GetAllGroupUnitCombinations(db *sql.DB, queryFi
 				}
 			}
 		case "technology":
-			techs, err := GetUniqueTechnologies(db)
+			techs, err := GetUniqueTechnologies(ctx, db)
 			if err != nil {
-				return nil, nil, errors.New(fmt.Sprintf("error retrieving unique techs: %v", err))
+				return nil, nil, fmt.Errorf("error retrieving unique techs: %w", err)
 			}
 			if len(groupedUnits) > 0 && len(groupedFilters) > 0 {
 				newFilters := make(map[string]UnitFilter)
@@ -469,6 +584,57 @@ func (g *GeneratorGroupedFilter) GetAllGroupUnitCombinations(db *sql.DB, queryFi
 					groupedUnits[tech] = units
 				}
 			}
+		case "station":
+			stations, err := GetUniqueStations(ctx, db)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error retrieving unique stations: %w", err)
+			}
+			if len(groupedUnits) > 0 && len(groupedFilters) > 0 {
+				newFilters := make(map[string]UnitFilter)
+				newUnits := make(map[string][]Unit)
+
+				for filterName, filter := range groupedFilters {
+					filterUnits := groupedUnits[filterName]
+					for _, station := range stations {
+						filterName := filterName + "+" + station
+						filter.StationName.eq = []string{station}
+						filter.MaxCapacity = IntFilter{
+							lt: -1,
+							gt: -1,
+							eq: -1,
+						}
+						newFilters[filterName] = filter
+
+						units := make([]Unit, 0)
+						for _, unit := range filterUnits {
+							if unit.StationName == station {
+								units = append(units, unit)
+							}
+						}
+						newUnits[filterName] = units
+					}
+				}
+				groupedFilters = newFilters
+				groupedUnits = newUnits
+			} else {
+				for _, station := range stations {
+					groupFilter := UnitFilter{}
+					groupFilter.StationName.eq = []string{station}
+					groupFilter.MaxCapacity = IntFilter{
+						lt: -1,
+						gt: -1,
+						eq: -1,
+					}
+					groupedFilters[station] = groupFilter
+					units := make([]Unit, 0)
+					for _, unit := range *allUnits {
+						if unit.StationName == station {
+							units = append(units, unit)
+						}
+					}
+					groupedUnits[station] = units
+				}
+			}
 		default:
 			return nil, nil, errors.New("unkown grouping")
 		}
@@ -0,0 +1,285 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Fill modes, how the intervals of a series without data are returned
+const (
+	FillNone     = "none"     // left out, the default
+	FillNull     = "null"     // returned with a null value
+	FillPrevious = "previous" // the last value before, null if there is none
+	FillLinear   = "linear"   // interpolated between the values either side, null at the ends of the series
+	FillZero     = "zero"     // returned as zero
+)
+
+var fillModes = []string{FillNone, FillNull, FillPrevious, FillLinear, FillZero}
+
+// ErrInvalidFill is returned for an unknown fill mode or an aggregate window it cannot be applied to
+var ErrInvalidFill = errors.New("invalid fill")
+
+// FillFilter is a type used to fill the missing intervals of time series after they are queried,
+// so the filling is the same whichever store answered the query
+type FillFilter struct {
+	mode string
+	err  error
+}
+
+func (f *FillFilter) fromFilterMap(filterMap map[string][]string, param string) {
+	f.mode = FillNone
+	if val, ok := filterMap[param]; ok {
+		if !containsString(fillModes, val[0]) {
+			f.err = fmt.Errorf("%w: fill must be one of none, null, previous, linear or zero", ErrInvalidFill)
+			return
+		}
+		f.mode = val[0]
+	}
+}
+
+// validate checks the aggregate window can be filled, months and years vary in length so
+// the windows Flux creates for them cannot be found without a calendar
+func (f *FillFilter) validate(agg AggregateFilter) {
+	if f.err != nil || !f.enabled() {
+		return
+	}
+	if _, ok := agg.window(); !ok {
+		return
+	}
+	for _, part := range fluxDurationPart.FindAllStringSubmatch(agg.every, -1) {
+		if part[2] == "mo" || part[2] == "y" {
+			f.err = fmt.Errorf("%w: fill cannot be used with aggregate.every in months or years", ErrInvalidFill)
+			return
+		}
+	}
+}
+
+// Err returns why the fill parameter is invalid, nil if it is valid or not given
+func (f FillFilter) Err() error {
+	return f.err
+}
+
+func (f FillFilter) enabled() bool {
+	return f.mode != "" && f.mode != FillNone
+}
+
+// times returns the times a filled series has a point at in the range, the stop of each aggregate
+// window, which aggregateWindow labels its windows with, or the end of each of the measurement's
+// intervals when not aggregated. Intervals still being reported, within one interval of now, are left out
+func (f FillFilter) times(rng RangeFilter, agg AggregateFilter, interval time.Duration, now time.Time) []time.Time {
+	times := make([]time.Time, 0)
+	if !f.enabled() || f.err != nil {
+		return times
+	}
+
+	start, stop := rng.bounds(now)
+	if latest := now.Add(-interval); stop.After(latest) {
+		stop = latest
+	}
+	if window, ok := agg.window(); ok && window > 0 {
+		// Windows are aligned to the unix epoch, the first is cut short by the range start
+		for t := floorEpoch(start, window).Add(window); !t.After(stop); t = t.Add(window) {
+			times = append(times, t)
+		}
+		return times
+	}
+
+	// The range includes its start and excludes its stop
+	t := floorEpoch(start, interval)
+	if t.Before(start) {
+		t = t.Add(interval)
+	}
+	for ; t.Before(stop); t = t.Add(interval) {
+		times = append(times, t)
+	}
+	return times
+}
+
+// floorEpoch rounds t down to a multiple of d since the unix epoch, as Flux aligns windows,
+// time.Truncate aligns to the zero time instead which differs for windows such as 7d
+func floorEpoch(t time.Time, d time.Duration) time.Time {
+	n := t.UnixNano()
+	mod := n % int64(d)
+	if mod < 0 {
+		mod += int64(d)
+	}
+	return time.Unix(0, n-mod).UTC()
+}
+
+// fill returns the series with a point at each of times, keeping points at other times,
+// missing values are set by the mode, NaN for null
+func (f FillFilter) fill(points []DataPoint, times []time.Time) []DataPoint {
+	if !f.enabled() || len(times) == 0 {
+		return points
+	}
+	if !sort.SliceIsSorted(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) }) {
+		sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	}
+
+	filled := make([]DataPoint, 0, len(times)+len(points))
+	missing := make([]bool, 0, len(times)+len(points))
+	i := 0
+	for _, t := range times {
+		for ; i < len(points) && points[i].Time.Before(t); i++ {
+			filled, missing = append(filled, points[i]), append(missing, false)
+		}
+		if i < len(points) && points[i].Time.Equal(t) {
+			filled, missing = append(filled, points[i]), append(missing, false)
+			i++
+			continue
+		}
+		filled, missing = append(filled, DataPoint{Time: t, Value: math.NaN()}), append(missing, true)
+	}
+	for ; i < len(points); i++ {
+		filled, missing = append(filled, points[i]), append(missing, false)
+	}
+
+	switch f.mode {
+	case FillZero:
+		for k := range filled {
+			if missing[k] {
+				filled[k].Value = 0
+			}
+		}
+	case FillPrevious:
+		previous := math.NaN()
+		for k := range filled {
+			if missing[k] {
+				filled[k].Value = previous
+			} else {
+				previous = filled[k].Value
+			}
+		}
+	case FillLinear:
+		// next[k] is the index of the first value after k, -1 if there is none
+		next := make([]int, len(filled))
+		n := -1
+		for k := len(filled) - 1; k >= 0; k-- {
+			next[k] = n
+			if !missing[k] {
+				n = k
+			}
+		}
+		last := -1
+		for k := range filled {
+			if !missing[k] {
+				last = k
+				continue
+			}
+			if last < 0 || next[k] < 0 {
+				continue
+			}
+			before, after := filled[last], filled[next[k]]
+			fraction := float64(filled[k].Time.Sub(before.Time)) / float64(after.Time.Sub(before.Time))
+			filled[k].Value = before.Value + fraction*(after.Value-before.Value)
+		}
+	}
+	return filled
+}
+
+// fillByRegion fills the series of each region of a measurement tagged by region,
+// keeping the regions in the order they were returned
+func (f FillFilter) fillByRegion(regionIDs []string, points []DataPoint, times []time.Time) ([]string, []DataPoint) {
+	if !f.enabled() || len(times) == 0 {
+		return regionIDs, points
+	}
+
+	order := make([]string, 0)
+	series := make(map[string][]DataPoint)
+	for i, regionID := range regionIDs {
+		if _, ok := series[regionID]; !ok {
+			order = append(order, regionID)
+		}
+		series[regionID] = append(series[regionID], points[i])
+	}
+
+	filledIDs, filled := make([]string, 0, len(points)), make([]DataPoint, 0, len(points))
+	for _, regionID := range order {
+		for _, point := range f.fill(series[regionID], times) {
+			filledIDs, filled = append(filledIDs, regionID), append(filled, point)
+		}
+	}
+	return filledIDs, filled
+}
+
+// fillDemand fills each region's demand series
+func (f FillFilter) fillDemand(points []DemandDataPoint, times []time.Time) []DemandDataPoint {
+	if !f.enabled() || len(times) == 0 {
+		return points
+	}
+	regionIDs, series := make([]string, 0, len(points)), make([]DataPoint, 0, len(points))
+	for _, p := range points {
+		regionIDs, series = append(regionIDs, p.RegionID), append(series, DataPoint{Time: p.Time, Value: p.Value})
+	}
+	regionIDs, series = f.fillByRegion(regionIDs, series, times)
+
+	filled := make([]DemandDataPoint, 0, len(series))
+	for i, p := range series {
+		filled = append(filled, DemandDataPoint{Time: p.Time, RegionID: regionIDs[i], Value: p.Value})
+	}
+	return filled
+}
+
+// fillRooftop fills each region's rooftop series
+func (f FillFilter) fillRooftop(points []RooftopDataPoint, times []time.Time) []RooftopDataPoint {
+	if !f.enabled() || len(times) == 0 {
+		return points
+	}
+	regionIDs, series := make([]string, 0, len(points)), make([]DataPoint, 0, len(points))
+	for _, p := range points {
+		regionIDs, series = append(regionIDs, p.RegionID), append(series, DataPoint{Time: p.Time, Value: p.Value})
+	}
+	regionIDs, series = f.fillByRegion(regionIDs, series, times)
+
+	filled := make([]RooftopDataPoint, 0, len(series))
+	for i, p := range series {
+		filled = append(filled, RooftopDataPoint{Time: p.Time, RegionID: regionIDs[i], Value: p.Value})
+	}
+	return filled
+}
+
+// fillSeries fills each generation series
+func (f FillFilter) fillSeries(data []GenerationDataPoint, times []time.Time) []GenerationDataPoint {
+	for i := range data {
+		data[i].Data = f.fill(data[i].Data, times)
+	}
+	return data
+}
+
+// jsonValue returns v for encoding, nil for the NaN of a null filled interval
+func jsonValue(v float64) *float64 {
+	if math.IsNaN(v) {
+		return nil
+	}
+	return &v
+}
+
+// MarshalJSON encodes the point, with a null value for intervals filled with null
+func (p DataPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Time  time.Time `json:"time"`
+		Value *float64  `json:"value"`
+	}{p.Time, jsonValue(p.Value)})
+}
+
+// MarshalJSON encodes the point, with a null value for intervals filled with null
+func (p DemandDataPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Time     time.Time `json:"time"`
+		RegionID string    `json:"region_id"`
+		Value    *float64  `json:"value"`
+	}{p.Time, p.RegionID, jsonValue(p.Value)})
+}
+
+// MarshalJSON encodes the point, with a null value for intervals filled with null
+func (p RooftopDataPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Time     time.Time `json:"time"`
+		RegionID string    `json:"region_id"`
+		Value    *float64  `json:"value"`
+	}{p.Time, p.RegionID, jsonValue(p.Value)})
+}
@@ -0,0 +1,258 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+// null marks a missing value in the tables below, filled points are compared with NaN as equal
+var null = math.NaN()
+
+// fillStart is the first interval of the filled series, times are 5 minutes apart
+var fillStart = time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+func fillTimes(n int) []time.Time {
+	times := make([]time.Time, 0, n)
+	for i := 0; i < n; i++ {
+		times = append(times, fillStart.Add(time.Duration(i)*GenerationInterval))
+	}
+	return times
+}
+
+// series returns a point at the i-th interval for each value that is not null
+func series(values ...float64) []DataPoint {
+	points := make([]DataPoint, 0, len(values))
+	for i, value := range values {
+		if !math.IsNaN(value) {
+			points = append(points, DataPoint{Time: fillStart.Add(time.Duration(i) * GenerationInterval), Value: value})
+		}
+	}
+	return points
+}
+
+func samePoints(got []DataPoint, want []DataPoint) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if !got[i].Time.Equal(want[i].Time) {
+			return false
+		}
+		if got[i].Value != want[i].Value && !(math.IsNaN(got[i].Value) && math.IsNaN(want[i].Value)) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFill(t *testing.T) {
+	gapped := []float64{10, null, 30, null, null, 60}
+	leading := []float64{null, null, 20, 30, 40, 50}
+	trailing := []float64{10, 20, 30, null, null, null}
+	empty := []float64{null, null, null, null, null, null}
+
+	tests := []struct {
+		name   string
+		mode   string
+		values []float64
+		want   []DataPoint
+	}{
+		{"gapped none", FillNone, gapped, series(10, null, 30, null, null, 60)},
+		{"gapped null", FillNull, gapped, fillAll(10, null, 30, null, null, 60)},
+		{"gapped previous", FillPrevious, gapped, fillAll(10, 10, 30, 30, 30, 60)},
+		{"gapped linear", FillLinear, gapped, fillAll(10, 20, 30, 40, 50, 60)},
+		{"gapped zero", FillZero, gapped, fillAll(10, 0, 30, 0, 0, 60)},
+
+		{"leading gap none", FillNone, leading, series(null, null, 20, 30, 40, 50)},
+		{"leading gap null", FillNull, leading, fillAll(null, null, 20, 30, 40, 50)},
+		{"leading gap previous", FillPrevious, leading, fillAll(null, null, 20, 30, 40, 50)},
+		{"leading gap linear", FillLinear, leading, fillAll(null, null, 20, 30, 40, 50)},
+		{"leading gap zero", FillZero, leading, fillAll(0, 0, 20, 30, 40, 50)},
+
+		{"trailing gap none", FillNone, trailing, series(10, 20, 30, null, null, null)},
+		{"trailing gap null", FillNull, trailing, fillAll(10, 20, 30, null, null, null)},
+		{"trailing gap previous", FillPrevious, trailing, fillAll(10, 20, 30, 30, 30, 30)},
+		{"trailing gap linear", FillLinear, trailing, fillAll(10, 20, 30, null, null, null)},
+		{"trailing gap zero", FillZero, trailing, fillAll(10, 20, 30, 0, 0, 0)},
+
+		{"empty none", FillNone, empty, []DataPoint{}},
+		{"empty null", FillNull, empty, fillAll(null, null, null, null, null, null)},
+		{"empty previous", FillPrevious, empty, fillAll(null, null, null, null, null, null)},
+		{"empty linear", FillLinear, empty, fillAll(null, null, null, null, null, null)},
+		{"empty zero", FillZero, empty, fillAll(0, 0, 0, 0, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := FillFilter{mode: tt.mode}
+			got := f.fill(series(tt.values...), fillTimes(len(tt.values)))
+			if !samePoints(got, tt.want) {
+				t.Errorf("fill = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fillAll returns a point at every interval, including null values
+func fillAll(values ...float64) []DataPoint {
+	points := make([]DataPoint, 0, len(values))
+	for i, value := range values {
+		points = append(points, DataPoint{Time: fillStart.Add(time.Duration(i) * GenerationInterval), Value: value})
+	}
+	return points
+}
+
+// TestFillKeepsPointsBetweenTimes checks points off the filled times are kept in order and
+// used as the neighbours of interpolated values
+func TestFillKeepsPointsBetweenTimes(t *testing.T) {
+	offGrid := DataPoint{Time: fillStart.Add(12 * time.Minute), Value: 24}
+	points := []DataPoint{
+		{Time: fillStart.Add(20 * time.Minute), Value: 40},
+		offGrid,
+		{Time: fillStart, Value: 0},
+	}
+
+	got := FillFilter{mode: FillLinear}.fill(points, fillTimes(5))
+	want := []DataPoint{
+		{Time: fillStart, Value: 0},
+		{Time: fillStart.Add(5 * time.Minute), Value: 10},
+		{Time: fillStart.Add(10 * time.Minute), Value: 20},
+		offGrid,
+		{Time: fillStart.Add(15 * time.Minute), Value: 30},
+		{Time: fillStart.Add(20 * time.Minute), Value: 40},
+	}
+	if !samePoints(got, want) {
+		t.Errorf("fill = %v, want %v", got, want)
+	}
+}
+
+func TestFillByRegion(t *testing.T) {
+	times := fillTimes(3)
+	points := []DemandDataPoint{
+		{Time: times[2], RegionID: "SA1", Value: 3},
+		{Time: times[0], RegionID: "NSW1", Value: 1},
+		{Time: times[0], RegionID: "SA1", Value: 1},
+		{Time: times[2], RegionID: "NSW1", Value: 5},
+	}
+
+	got := FillFilter{mode: FillPrevious}.fillDemand(points, times)
+	want := []DemandDataPoint{
+		{Time: times[0], RegionID: "SA1", Value: 1},
+		{Time: times[1], RegionID: "SA1", Value: 1},
+		{Time: times[2], RegionID: "SA1", Value: 3},
+		{Time: times[0], RegionID: "NSW1", Value: 1},
+		{Time: times[1], RegionID: "NSW1", Value: 1},
+		{Time: times[2], RegionID: "NSW1", Value: 5},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("fillDemand = %v, want %v", got, want)
+	}
+	for i := range got {
+		if !got[i].Time.Equal(want[i].Time) || got[i].RegionID != want[i].RegionID || got[i].Value != want[i].Value {
+			t.Fatalf("fillDemand = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestFillTimes(t *testing.T) {
+	now := time.Date(2024, 1, 31, 1, 2, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		rng   RangeFilter
+		agg   AggregateFilter
+		first time.Time
+		last  time.Time
+		count int
+	}{
+		{
+			name:  "intervals from the first after the start",
+			rng:   RangeFilter{start: "2024-01-31T00:02:00Z", stop: "2024-01-31T00:30:00Z"},
+			first: time.Date(2024, 1, 31, 0, 5, 0, 0, time.UTC),
+			last:  time.Date(2024, 1, 31, 0, 25, 0, 0, time.UTC),
+			count: 5,
+		},
+		{
+			name:  "intervals still being reported are left out",
+			rng:   RangeFilter{start: "2024-01-31T00:30:00Z"},
+			first: time.Date(2024, 1, 31, 0, 30, 0, 0, time.UTC),
+			last:  time.Date(2024, 1, 31, 0, 55, 0, 0, time.UTC),
+			count: 6,
+		},
+		{
+			name:  "windows labelled by their stop",
+			rng:   RangeFilter{start: "2024-01-31T00:02:00Z", stop: "2024-01-31T01:00:00Z"},
+			agg:   AggregateFilter{every: "15m", fn: "mean"},
+			first: time.Date(2024, 1, 31, 0, 15, 0, 0, time.UTC),
+			last:  time.Date(2024, 1, 31, 0, 45, 0, 0, time.UTC),
+			count: 3,
+		},
+		{
+			name:  "week windows aligned to the unix epoch",
+			rng:   RangeFilter{start: "2024-01-01T00:00:00Z", stop: "2024-01-30T00:00:00Z"},
+			agg:   AggregateFilter{every: "7d", fn: "mean"},
+			first: time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC), // a Thursday, as 1 January 1970 was
+			last:  time.Date(2024, 1, 25, 0, 0, 0, 0, time.UTC),
+			count: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			times := FillFilter{mode: FillNull}.times(tt.rng, tt.agg, GenerationInterval, now)
+			if len(times) != tt.count {
+				t.Fatalf("got %d times %v, want %d", len(times), times, tt.count)
+			}
+			if !times[0].Equal(tt.first) || !times[len(times)-1].Equal(tt.last) {
+				t.Errorf("times run from %s to %s, want %s to %s", times[0], times[len(times)-1], tt.first, tt.last)
+			}
+		})
+	}
+
+	if times := (FillFilter{mode: FillNone}).times(tests[0].rng, AggregateFilter{}, GenerationInterval, now); len(times) != 0 {
+		t.Errorf("fill none returned %d times, want none", len(times))
+	}
+}
+
+func TestFillFilterValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		fill  string
+		every string
+		valid bool
+	}{
+		{"unknown mode", "mean", "", false},
+		{"not aggregated", FillLinear, "", true},
+		{"minutes", FillNull, "30m", true},
+		{"months", FillNull, "1mo", false},
+		{"mixed with years", FillZero, "1y2d", false},
+		{"none with months", FillNone, "1mo", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var f FillFilter
+			f.fromFilterMap(map[string][]string{"fill": {tt.fill}}, "fill")
+			agg := AggregateFilter{}
+			if tt.every != "" {
+				agg = AggregateFilter{every: tt.every, fn: "mean"}
+			}
+			f.validate(agg)
+			if valid := f.Err() == nil; valid != tt.valid {
+				t.Errorf("valid = %v, want %v: %v", valid, tt.valid, f.Err())
+			}
+		})
+	}
+}
+
+func TestFilledPointJSON(t *testing.T) {
+	body, err := json.Marshal(fillAll(1.5, null))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"time":"2024-01-31T00:00:00Z","value":1.5},{"time":"2024-01-31T00:05:00Z","value":null}]`
+	if string(body) != want {
+		t.Errorf("json = %s, want %s", body, want)
+	}
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// kmPerDegree is the length of a degree of latitude, using the mean Earth radius of 6371km
+const kmPerDegree = 6371 * math.Pi / 180
+
+// ErrInvalidLocationFilter is returned for malformed bbox, near and radius parameters
+var ErrInvalidLocationFilter = errors.New("invalid location filter")
+
+// GeoFilter is a type used to filter units by location in an SQL Query
+// bbox - minLon,minLat,maxLon,maxLat as in GeoJSON
+// near - lat,lon of the centre of a radius in km
+// Units without a location never match
+type GeoFilter struct {
+	bbox   []float64
+	near   []float64
+	radius float64
+	err    error
+}
+
+// Feature is a GeoJSON feature, Geometry is nil for features without a location
+type Feature struct {
+	Type       string      `json:"type"`
+	ID         string      `json:"id,omitempty"`
+	Geometry   *Point      `json:"geometry"`
+	Properties interface{} `json:"properties"`
+}
+
+// Point is a GeoJSON point, coordinates are longitude then latitude
+type Point struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// FeatureCollection is a GeoJSON feature collection, Meta is a foreign member for paging
+type FeatureCollection struct {
+	Type     string                 `json:"type"`
+	Features []Feature              `json:"features"`
+	Meta     map[string]interface{} `json:"meta,omitempty"`
+}
+
+func (f *GeoFilter) fromFilterMap(filterMap map[string][]string) {
+	if val, ok := filterMap["bbox"]; ok {
+		f.bbox, f.err = parseCoordinates(val[0], 4)
+		if f.err == nil && (f.bbox[0] > f.bbox[2] || f.bbox[1] > f.bbox[3]) {
+			f.err = fmt.Errorf("%w: bbox must be minLon,minLat,maxLon,maxLat", ErrInvalidLocationFilter)
+		}
+		if f.err != nil {
+			return
+		}
+	}
+
+	near, nearOK := filterMap["near"]
+	radius, radiusOK := filterMap["radius"]
+	if nearOK != radiusOK {
+		f.err = fmt.Errorf("%w: near and radius must be given together", ErrInvalidLocationFilter)
+		return
+	}
+	if !nearOK {
+		return
+	}
+	if f.near, f.err = parseCoordinates(near[0], 2); f.err != nil {
+		return
+	}
+	if f.near[0] < -90 || f.near[0] > 90 || f.near[1] < -180 || f.near[1] > 180 {
+		f.err = fmt.Errorf("%w: near must be lat,lon", ErrInvalidLocationFilter)
+		return
+	}
+	var err error
+	if f.radius, err = strconv.ParseFloat(radius[0], 64); err != nil || f.radius <= 0 {
+		f.err = fmt.Errorf("%w: radius must be a positive number of km", ErrInvalidLocationFilter)
+	}
+}
+
+// Err returns why the location parameters could not be parsed, nil if they were valid or absent
+func (f GeoFilter) Err() error {
+	return f.err
+}
+
+func parseCoordinates(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("%w: expected %d comma separated numbers, got %s", ErrInvalidLocationFilter, n, s)
+	}
+	coordinates := make([]float64, 0, n)
+	for _, part := range parts {
+		c, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(c) || math.IsInf(c, 0) {
+			return nil, fmt.Errorf("%w: %s is not a number", ErrInvalidLocationFilter, part)
+		}
+		coordinates = append(coordinates, c)
+	}
+	return coordinates, nil
+}
+
+// buildGeoFilterSQLStatement filters by bounding box and radius, the radius uses an equirectangular
+// projection about its centre, within 1% of the great circle distance up to a few hundred km
+func buildGeoFilterSQLStatement(filter GeoFilter) (string, bool) {
+	if filter.err != nil {
+		// Match nothing rather than everything, callers check Err first
+		return "(0)", true
+	}
+
+	clauses := make([]string, 0, 2)
+	if filter.bbox != nil {
+		clauses = append(clauses, fmt.Sprintf("latitude BETWEEN %s AND %s AND longitude BETWEEN %s AND %s",
+			formatFloat(filter.bbox[1]), formatFloat(filter.bbox[3]), formatFloat(filter.bbox[0]), formatFloat(filter.bbox[2])))
+	}
+	if filter.near != nil {
+		lat, lon := filter.near[0], filter.near[1]
+		scale := math.Cos(lat * math.Pi / 180)
+		degrees := filter.radius / kmPerDegree
+		clauses = append(clauses, fmt.Sprintf(
+			"(latitude - %[1]s) * (latitude - %[1]s) + (longitude - %[2]s) * (longitude - %[2]s) * %[3]s <= %[4]s",
+			formatFloat(lat), formatFloat(lon), formatFloat(scale*scale), formatFloat(degrees*degrees)))
+	}
+
+	if len(clauses) == 0 {
+		return "", false
+	}
+	return "(" + strings.Join(clauses, " AND ") + ")", true
+}
+
+// UnitFeatures returns units as GeoJSON features identified by DUID, properties holds the unit's
+// other fields, or only those given in fields
+func UnitFeatures(units []Unit, fields []string) []Feature {
+	features := make([]Feature, 0, len(units))
+	for _, u := range units {
+		feature := Feature{Type: "Feature", ID: u.DuID}
+		if u.Latitude != nil && u.Longitude != nil {
+			feature.Geometry = &Point{Type: "Point", Coordinates: [2]float64{*u.Longitude, *u.Latitude}}
+		}
+		if len(fields) != 0 {
+			feature.Properties = u.SelectFields(fields, false)
+		} else {
+			feature.Properties = u.View()
+		}
+		features = append(features, feature)
+	}
+	return features
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
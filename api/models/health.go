@@ -0,0 +1,60 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"NemWebGoApi/internal/metrics"
+
+	"github.com/influxdata/influxdb-client-go/v2/api"
+)
+
+// PingUnits runs a trivial query against the units table,
+// failing if the table does not exist or the database cannot be read
+func PingUnits(ctx context.Context, db *sql.DB) error {
+	var one int
+	err := db.QueryRowContext(ctx, "SELECT 1 FROM units LIMIT 1").Scan(&one)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("models.PingUnits: query error: %w", err)
+	}
+	return nil
+}
+
+// ReadLatestDemandTimes returns the time of the most recent demand point for each region,
+// looking back at most lookback
+func ReadLatestDemandTimes(ctx context.Context, db api.QueryAPI, bucket string, lookback time.Duration) (map[string]time.Time, error) {
+	latest := make(map[string]time.Time)
+
+	fluxQuery := fmt.Sprintf("from(bucket: \"%s\")", bucket)
+	fluxQuery += fmt.Sprintf("\n\t|> range(start: -%ds)", int64(lookback.Seconds()))
+	fluxQuery += "\n\t|> filter(fn: (r) => r._measurement == \"demand\")"
+	fluxQuery += "\n\t|> group(columns: [\"regionId\"])"
+	fluxQuery += "\n\t|> last()"
+
+	ctx, done := startQuery(ctx, metrics.StoreInflux, "demand", fluxQuery)
+	result, err := db.Query(ctx, fluxQuery)
+	if err != nil {
+		done(0, err)
+		return latest, fmt.Errorf("models.ReadLatestDemandTimes: query error: %w", err)
+	}
+	defer result.Close()
+
+	rows := 0
+	for result.Next() {
+		rows++
+		region := fmt.Sprintf("%v", result.Record().ValueByKey("regionId"))
+		if t := result.Record().Time(); t.After(latest[region]) {
+			latest[region] = t
+		}
+	}
+
+	if result.Err() != nil {
+		done(0, result.Err())
+		return latest, fmt.Errorf("models.ReadLatestDemandTimes: query parsing error: %w", result.Err())
+	}
+
+	done(rows, nil)
+	return latest, nil
+}
@@ -1,11 +1,20 @@
 package models
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"reflect"
 	"regexp"
 	"strconv"
+	"time"
+
+	"NemWebGoApi/internal/logging"
+	"NemWebGoApi/internal/metrics"
+	"NemWebGoApi/internal/tracing"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // StringFilter is a type used to filter with strings in an SQL or Flux Query
@@ -219,9 +228,10 @@ func buildInt64FilterSQLStatement(filter IntFilter, colName string) (string, boo
 	return stmt, true
 }
 
-func buildAggregateFilterFluxStatement(filter AggregateFilter) (string, bool) {
+func buildAggregateFilterFluxStatement(ctx context.Context, filter AggregateFilter) (string, bool) {
 	// https://docs.influxdata.com/flux/v0.x/stdlib/universe/aggregatewindow/
 	// |> aggregateWindow(every: v.windowPeriod, fn: mean, createEmpty: false)
+	// Empty windows are not created, the fill parameter fills them after the query, see FillFilter
 	everyValid, fnValid := false, false
 	for _, v := range aggregateFunctions {
 		if v == filter.fn {
@@ -234,7 +244,7 @@ func buildAggregateFilterFluxStatement(filter AggregateFilter) (string, bool) {
 	everyValid, _ = regexp.MatchString("^((\\d+)(ns|us|ms|s|m|h|d|w|mo|y))+$", filter.every)
 
 	if !everyValid || !fnValid {
-        fmt.Println(fmt.Sprintf("Aggregate Filter Incorrect, Time: %v, Fn: %v", everyValid, fnValid))
+		logging.FromContext(ctx).Debugf("Aggregate Filter Incorrect, Time: %v, Fn: %v", everyValid, fnValid)
 		return "", false
 	}
 
@@ -286,6 +296,11 @@ func buildSQLQuery(filter interface{}) string {
 			if val, ok := buildInt64FilterSQLStatement(concreteVal, col); ok {
 				filterArr = append(filterArr, val)
 			}
+		case reflect.TypeOf(GeoFilter{}):
+			concreteVal, _ := fieldVal.Interface().(GeoFilter)
+			if val, ok := buildGeoFilterSQLStatement(concreteVal); ok {
+				filterArr = append(filterArr, val)
+			}
 		}
 	}
 
@@ -304,7 +319,7 @@ func buildSQLQuery(filter interface{}) string {
 	return stmt
 }
 
-func buildFluxQuery(filter interface{}) string {
+func buildFluxQuery(ctx context.Context, filter interface{}) string {
 	var stmt string
 	filterArr := make([]string, 0)
 
@@ -327,7 +342,7 @@ func buildFluxQuery(filter interface{}) string {
 			}
 		case reflect.TypeOf(AggregateFilter{}):
 			concreteVal, _ := fieldVal.Interface().(AggregateFilter)
-			if val, ok := buildAggregateFilterFluxStatement(concreteVal); ok {
+			if val, ok := buildAggregateFilterFluxStatement(ctx, concreteVal); ok {
 				filterArr = append(filterArr, val)
 			}
 		case reflect.TypeOf(RangeFilter{}):
@@ -351,7 +366,7 @@ func buildFluxQuery(filter interface{}) string {
 
 // ParseFilterMap converts the query parameters returned by net/http into a filter as defined in the destination
 // TODO: Finish - may not be possible easily
-func ParseFilterMap(filterMap map[string][]string, dest interface{}) {
+func ParseFilterMap(ctx context.Context, filterMap map[string][]string, dest interface{}) {
 	v := reflect.Indirect(reflect.ValueOf(dest))
 	t := v.Type()
 
@@ -366,8 +381,7 @@ func ParseFilterMap(filterMap map[string][]string, dest interface{}) {
 		case reflect.TypeOf(StringFilter{}):
 			elementName := param + ".li"
 			if val, ok := filterMap[elementName]; ok {
-				fmt.Println("Found: ", elementName)
-				fmt.Println(val)
+				logging.FromContext(ctx).Traceln("Found: ", elementName, val)
 			}
 
 		case reflect.TypeOf(IntFilter{}):
@@ -409,3 +423,32 @@ func validUnixTime(s string) bool {
 	}
 	return v
 }
+
+// startQuery starts a trace span and timer for an upstream query, the returned function
+// must be called with the rows read and any error once the query has been consumed
+func startQuery(ctx context.Context, store string, measurement string, query string) (context.Context, func(rows int, err error)) {
+	start := time.Now()
+	ctx, span := tracing.StartQuery(ctx, store, measurement, query)
+
+	return ctx, func(rows int, err error) {
+		elapsed := time.Since(start)
+		metrics.UpstreamQueryDuration.Observe(elapsed.Seconds(), store, measurement)
+		logger := logging.FromContext(ctx).WithFields(log.Fields{
+			"store":       store,
+			"measurement": measurement,
+			"rows":        rows,
+			"duration_ms": float64(elapsed.Microseconds()) / 1000,
+		})
+		if err != nil {
+			logger = logger.WithError(err)
+		}
+		logger.Debugln("upstream query")
+		if err != nil {
+			metrics.UpstreamQueryErrors.Inc(store, measurement)
+		} else {
+			metrics.UpstreamRowsReturned.Add(float64(rows), store, measurement)
+			span.SetAttributes(attribute.Int("db.rows_returned", rows))
+		}
+		tracing.EndSpan(span, err)
+	}
+}
@@ -0,0 +1,442 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"NemWebGoApi/internal/metrics"
+
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/query"
+)
+
+// DefaultStaleAfter is how long a unit may go without generation before it is reported stale
+const DefaultStaleAfter = time.Hour
+
+// suspiciousTolerance is how far in MW generation may go below zero or above max_capacity before
+// it is reported, SCADA readings of idle units hover around zero
+const suspiciousTolerance = 1.0
+
+// Reasons a generation value is suspicious
+const (
+	SuspiciousNegative    = "negative"
+	SuspiciousAboveMaxCap = "above_max_capacity"
+)
+
+// MaxUnknownUnits is the most unknown DUIDs a quality report lists, the scan for them is costed
+// as this many series
+const MaxUnknownUnits = 100
+
+// ErrInvalidQualityFilter is returned for a malformed stale parameter
+var ErrInvalidQualityFilter = errors.New("invalid quality filter")
+
+// qualityMeasurements are the measurements checked for missing intervals at their native interval
+var qualityMeasurements = []struct {
+	name     string
+	interval time.Duration
+}{
+	{"demand", DemandInterval},
+	{"rooftop", RooftopInterval},
+	{"generation", GenerationInterval},
+}
+
+// QualityFilter is the range and regions a quality report covers, generation is assigned to
+// regions through the units table
+type QualityFilter struct {
+	Range      RangeFilter `col:"range"` // col is unused for range but required for parsing
+	RegionID   StringFilter
+	StaleAfter time.Duration
+}
+
+// DataGap is a run of consecutive intervals without any point for a measurement in a region
+type DataGap struct {
+	Measurement string    `json:"measurement"`
+	RegionID    string    `json:"region_id"`
+	Start       time.Time `json:"start"`
+	Stop        time.Time `json:"stop"`
+	Intervals   int       `json:"intervals"`
+}
+
+// SeriesCoverage counts the intervals of a measurement in a region and how many are missing
+type SeriesCoverage struct {
+	Measurement string `json:"measurement"`
+	RegionID    string `json:"region_id"`
+	Interval    string `json:"interval"`
+	Expected    int    `json:"expected"`
+	Missing     int    `json:"missing"`
+}
+
+// StaleUnit is a unit without generation since LastSeen, nil if it has none in the range
+type StaleUnit struct {
+	DuID        string     `json:"duid"`
+	StationName string     `json:"station_name"`
+	RegionID    string     `json:"region_id"`
+	LastSeen    *time.Time `json:"last_seen"`
+}
+
+// UnknownUnit is a DUID with generation that is not in the units table
+type UnknownUnit struct {
+	DuID     string    `json:"duid"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// SuspiciousValue is the most extreme implausible generation of a unit in the range
+type SuspiciousValue struct {
+	DuID        string    `json:"duid"`
+	Reason      string    `json:"reason"`
+	Value       float64   `json:"value"`
+	Time        time.Time `json:"time"`
+	MaxCapacity int64     `json:"max_capacity"`
+}
+
+// QualityReport describes the completeness and plausibility of the data over a range
+type QualityReport struct {
+	Start        time.Time         `json:"start"`
+	Stop         time.Time         `json:"stop"`
+	Coverage     []SeriesCoverage  `json:"coverage"`
+	Gaps         []DataGap         `json:"gaps"`
+	StaleUnits   []StaleUnit       `json:"stale_units"`
+	UnknownUnits []UnknownUnit     `json:"unknown_units"`
+	Suspicious   []SuspiciousValue `json:"suspicious"`
+}
+
+// ParseQualityFilterMap reads range.start, range.stop, region_id and stale, a duration such as 30m or 2h
+func ParseQualityFilterMap(filterMap map[string][]string) (QualityFilter, error) {
+	filter := QualityFilter{StaleAfter: DefaultStaleAfter}
+	filter.Range.fromFilterMap(filterMap, "range")
+	filter.RegionID.fromFilterMap(filterMap, "region_id")
+	if val, ok := filterMap["stale"]; ok {
+		stale, ok := parseFluxDuration(val[0])
+		if !ok || stale <= 0 {
+			return filter, fmt.Errorf("%w: stale must be a positive duration such as 30m or 2h", ErrInvalidQualityFilter)
+		}
+		filter.StaleAfter = stale
+	}
+	return filter, nil
+}
+
+// ReadQualityReport checks the data in the range for missing intervals per measurement and region,
+// units in the units table without recent generation, generation from DUIDs not in the units table,
+// and generation below zero for units that are not storage or above the unit's max_capacity
+// Intervals still being reported, within one interval of now, are not counted as missing
+func ReadQualityReport(ctx context.Context, db api.QueryAPI, sqlDB *sql.DB, bucket string, filter QualityFilter) (*QualityReport, error) {
+	now := time.Now().UTC()
+	start, stop := filter.Range.bounds(now)
+	report := &QualityReport{
+		Start:        start.UTC(),
+		Stop:         stop.UTC(),
+		Coverage:     make([]SeriesCoverage, 0),
+		Gaps:         make([]DataGap, 0),
+		StaleUnits:   make([]StaleUnit, 0),
+		UnknownUnits: make([]UnknownUnit, 0),
+		Suspicious:   make([]SuspiciousValue, 0),
+	}
+
+	regions, units, regionUnits, err := qualityUnits(ctx, sqlDB, filter)
+	if err != nil {
+		return nil, fmt.Errorf("models.ReadQualityReport: %w", err)
+	}
+
+	for _, m := range qualityMeasurements {
+		if err := readGaps(ctx, db, bucket, report, m.name, m.interval, start, stop, now, regions, regionUnits); err != nil {
+			return nil, err
+		}
+	}
+	if err := readUnitQuality(ctx, db, bucket, report, units, regionUnits, start, stop, filter.StaleAfter); err != nil {
+		return nil, err
+	}
+	if len(filter.RegionID.GetEq()) == 0 {
+		if err := readUnknownUnits(ctx, db, bucket, report, units, start, stop); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// QualitySeries returns the number of series a quality report reads, one per region, one per
+// unit in the regions and, without a region filter, MaxUnknownUnits for the unknown units
+func QualitySeries(ctx context.Context, sqlDB *sql.DB, filter QualityFilter) (int, error) {
+	regions, _, regionUnits, err := qualityUnits(ctx, sqlDB, filter)
+	if err != nil {
+		return 0, fmt.Errorf("models.QualitySeries: %w", err)
+	}
+	series := len(regions)
+	for _, duids := range regionUnits {
+		series += len(duids)
+	}
+	if len(filter.RegionID.GetEq()) == 0 {
+		series += MaxUnknownUnits
+	}
+	return series, nil
+}
+
+// qualityUnits returns the regions of the filter, every unit by DUID, and the DUIDs of the units
+// in each of the regions
+func qualityUnits(ctx context.Context, sqlDB *sql.DB, filter QualityFilter) ([]string, map[string]Unit, map[string][]string, error) {
+	unit := Unit{}
+	all, err := unit.ReadAll(ctx, sqlDB, ParseUnitFilterMap(map[string][]string{}))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	regions := filter.RegionID.GetEq()
+	if len(regions) == 0 {
+		regions = NEMRegions
+	}
+	units := make(map[string]Unit)
+	regionUnits := make(map[string][]string)
+	for _, u := range *all {
+		units[u.DuID] = u
+		if containsString(regions, u.RegionID) {
+			regionUnits[u.RegionID] = append(regionUnits[u.RegionID], u.DuID)
+		}
+	}
+	return regions, units, regionUnits, nil
+}
+
+// readGaps finds the empty intervals of a measurement per region, demand and rooftop are tagged
+// by region, generation is counted over the units of each region
+func readGaps(ctx context.Context, db api.QueryAPI, bucket string, report *QualityReport, measurement string, interval time.Duration,
+	start time.Time, stop time.Time, now time.Time, regions []string, regionUnits map[string][]string) error {
+	// Whole intervals only, ending before the interval still being reported
+	if latest := now.Add(-interval); stop.After(latest) {
+		stop = latest
+	}
+	stop = stop.Truncate(interval)
+	if aligned := start.Truncate(interval); aligned.Before(start) {
+		start = aligned.Add(interval)
+	}
+	if !stop.After(start) {
+		return nil
+	}
+	expected := int(stop.Sub(start) / interval)
+
+	windows := fmt.Sprintf("\n\t|> aggregateWindow(every: %s, fn: count, createEmpty: true, timeSrc: \"_start\")", interval)
+	windows += "\n\t|> filter(fn: (r) => r._value == 0)"
+	base := fmt.Sprintf("from(bucket: \"%s\")", bucket)
+	base += fmt.Sprintf("\n\t|> range(start: %s, stop: %s)", start.Format(time.RFC3339), stop.Format(time.RFC3339))
+	base += fmt.Sprintf("\n\t|> filter(fn: (r) => r._measurement == \"%s\")", measurement)
+
+	empty := make(map[string][]time.Time)
+	seen := make(map[string]bool)
+	if measurement == "generation" {
+		for _, region := range regions {
+			duids := regionUnits[region]
+			if len(duids) == 0 {
+				continue
+			}
+			unitFilter, _ := buildStringFilterFluxStatement(StringFilter{eq: duids}, "unit")
+			fluxQuery := base + "\n" + unitFilter + "\n\t|> group()" + windows
+			// A region with no generation at all returns no empty windows rather than all of them
+			err := runQualityQuery(ctx, db, measurement, base+"\n"+unitFilter+"\n\t|> group()\n\t|> limit(n: 1)", func(*query.FluxRecord) {
+				seen[region] = true
+			})
+			if err != nil {
+				return err
+			}
+			if !seen[region] {
+				continue
+			}
+			err = runQualityQuery(ctx, db, measurement, fluxQuery, func(record *query.FluxRecord) {
+				empty[region] = append(empty[region], record.Time())
+			})
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		regionFilter, _ := buildStringFilterFluxStatement(StringFilter{eq: regions}, "regionId")
+		fluxQuery := base + "\n" + regionFilter + "\n\t|> group(columns: [\"regionId\"])"
+		fluxQuery += fmt.Sprintf("\n\t|> aggregateWindow(every: %s, fn: count, createEmpty: true, timeSrc: \"_start\")", interval)
+		err := runQualityQuery(ctx, db, measurement, fluxQuery, func(record *query.FluxRecord) {
+			region := fmt.Sprintf("%v", record.ValueByKey("regionId"))
+			seen[region] = true
+			if count, _ := getFloatReflectOnly(record.Value()); count == 0 {
+				empty[region] = append(empty[region], record.Time())
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, region := range regions {
+		if measurement == "generation" && len(regionUnits[region]) == 0 {
+			continue
+		}
+		times := empty[region]
+		if !seen[region] {
+			// No points at all, every interval is missing
+			times = make([]time.Time, 0, expected)
+			for t := start; t.Before(stop); t = t.Add(interval) {
+				times = append(times, t)
+			}
+		}
+		sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+		report.Coverage = append(report.Coverage, SeriesCoverage{
+			Measurement: measurement, RegionID: region, Interval: interval.String(), Expected: expected, Missing: len(times),
+		})
+		for i, t := range times {
+			n := len(report.Gaps) - 1
+			if i > 0 && report.Gaps[n].Stop.Equal(t) {
+				report.Gaps[n].Stop = t.Add(interval)
+				report.Gaps[n].Intervals++
+				continue
+			}
+			report.Gaps = append(report.Gaps, DataGap{
+				Measurement: measurement, RegionID: region, Start: t.UTC(), Stop: t.Add(interval).UTC(), Intervals: 1,
+			})
+		}
+	}
+	return nil
+}
+
+// readUnitQuality compares the latest, lowest and highest generation of the units in the regions
+// with the units table
+func readUnitQuality(ctx context.Context, db api.QueryAPI, bucket string, report *QualityReport, units map[string]Unit,
+	regionUnits map[string][]string, start time.Time, stop time.Time, staleAfter time.Duration) error {
+	duids := make([]string, 0)
+	for _, region := range regionUnits {
+		duids = append(duids, region...)
+	}
+	if len(duids) == 0 {
+		return nil
+	}
+	sort.Strings(duids)
+	unitFilter, _ := buildStringFilterFluxStatement(StringFilter{eq: duids}, "unit")
+	base := fmt.Sprintf("from(bucket: \"%s\")", bucket)
+	base += fmt.Sprintf("\n\t|> range(start: %s, stop: %s)", start.Format(time.RFC3339), stop.Format(time.RFC3339))
+	base += "\n\t|> filter(fn: (r) => r._measurement == \"generation\")"
+	base += "\n" + unitFilter
+	base += "\n\t|> group(columns: [\"unit\"])"
+
+	type extreme struct {
+		value float64
+		time  time.Time
+	}
+	last := make(map[string]time.Time)
+	lowest := make(map[string]extreme)
+	highest := make(map[string]extreme)
+	for fn, collect := range map[string]func(*query.FluxRecord){
+		"last": func(record *query.FluxRecord) {
+			last[fmt.Sprintf("%v", record.ValueByKey("unit"))] = record.Time()
+		},
+		"min": func(record *query.FluxRecord) {
+			value, _ := getFloatReflectOnly(record.Value())
+			lowest[fmt.Sprintf("%v", record.ValueByKey("unit"))] = extreme{value, record.Time()}
+		},
+		"max": func(record *query.FluxRecord) {
+			value, _ := getFloatReflectOnly(record.Value())
+			highest[fmt.Sprintf("%v", record.ValueByKey("unit"))] = extreme{value, record.Time()}
+		},
+	} {
+		if err := runQualityQuery(ctx, db, "generation", base+"\n\t|> "+fn+"()", collect); err != nil {
+			return err
+		}
+	}
+
+	staleBefore := stop.Add(-staleAfter)
+	for _, duids := range regionUnits {
+		for _, duid := range duids {
+			seen, ok := last[duid]
+			if ok && !seen.Before(staleBefore) {
+				continue
+			}
+			stale := StaleUnit{DuID: duid, StationName: units[duid].StationName, RegionID: units[duid].RegionID}
+			if ok {
+				seen = seen.UTC()
+				stale.LastSeen = &seen
+			}
+			report.StaleUnits = append(report.StaleUnits, stale)
+		}
+	}
+	sort.Slice(report.StaleUnits, func(i, j int) bool { return report.StaleUnits[i].DuID < report.StaleUnits[j].DuID })
+
+	for duid, low := range lowest {
+		u, ok := units[duid]
+		if ok && low.value < -suspiciousTolerance && !isStorage(u) {
+			report.Suspicious = append(report.Suspicious, SuspiciousValue{
+				DuID: duid, Reason: SuspiciousNegative, Value: low.value, Time: low.time.UTC(), MaxCapacity: u.MaxCapacity,
+			})
+		}
+	}
+	for duid, high := range highest {
+		u, ok := units[duid]
+		if ok && u.MaxCapacity > 0 && high.value > float64(u.MaxCapacity)+suspiciousTolerance {
+			report.Suspicious = append(report.Suspicious, SuspiciousValue{
+				DuID: duid, Reason: SuspiciousAboveMaxCap, Value: high.value, Time: high.time.UTC(), MaxCapacity: u.MaxCapacity,
+			})
+		}
+	}
+	sort.Slice(report.Suspicious, func(i, j int) bool {
+		if report.Suspicious[i].DuID != report.Suspicious[j].DuID {
+			return report.Suspicious[i].DuID < report.Suspicious[j].DuID
+		}
+		return report.Suspicious[i].Reason < report.Suspicious[j].Reason
+	})
+	return nil
+}
+
+// readUnknownUnits lists up to MaxUnknownUnits DUIDs with generation in the range that are not in
+// the units table, by DUID, with their latest time
+func readUnknownUnits(ctx context.Context, db api.QueryAPI, bucket string, report *QualityReport, units map[string]Unit,
+	start time.Time, stop time.Time) error {
+	known := make([]string, 0, len(units))
+	for duid := range units {
+		known = append(known, fmt.Sprintf("%q", duid))
+	}
+	sort.Strings(known)
+
+	fluxQuery := fmt.Sprintf("from(bucket: \"%s\")", bucket)
+	fluxQuery += fmt.Sprintf("\n\t|> range(start: %s, stop: %s)", start.Format(time.RFC3339), stop.Format(time.RFC3339))
+	fluxQuery += "\n\t|> filter(fn: (r) => r._measurement == \"generation\")"
+	if len(known) != 0 {
+		fluxQuery += fmt.Sprintf("\n\t|> filter(fn: (r) => not contains(value: r.unit, set: [%s]))", strings.Join(known, ", "))
+	}
+	fluxQuery += "\n\t|> group(columns: [\"unit\"])\n\t|> last()"
+	fluxQuery += fmt.Sprintf("\n\t|> group()\n\t|> sort(columns: [\"unit\"])\n\t|> limit(n: %d)", MaxUnknownUnits)
+
+	return runQualityQuery(ctx, db, "generation", fluxQuery, func(record *query.FluxRecord) {
+		report.UnknownUnits = append(report.UnknownUnits, UnknownUnit{
+			DuID: fmt.Sprintf("%v", record.ValueByKey("unit")), LastSeen: record.Time().UTC(),
+		})
+	})
+}
+
+// isStorage returns true for units that draw from the grid when charging or pumping
+func isStorage(u Unit) bool {
+	kind := strings.ToLower(u.FuelSource + " " + u.TechnologyType)
+	for _, storage := range []string{"battery", "storage", "pump"} {
+		if strings.Contains(kind, storage) {
+			return true
+		}
+	}
+	return false
+}
+
+func runQualityQuery(ctx context.Context, db api.QueryAPI, measurement string, fluxQuery string, fn func(*query.FluxRecord)) error {
+	ctx, done := startQuery(ctx, metrics.StoreInflux, measurement, fluxQuery)
+	result, err := db.Query(ctx, fluxQuery)
+	if err != nil {
+		done(0, err)
+		return fmt.Errorf("models.ReadQualityReport: query error: %w", err)
+	}
+	defer result.Close()
+
+	rows := 0
+	for result.Next() {
+		rows++
+		fn(result.Record())
+	}
+	if result.Err() != nil {
+		done(0, result.Err())
+		return fmt.Errorf("models.ReadQualityReport: query parsing error: %w", result.Err())
+	}
+	done(rows, nil)
+	return nil
+}
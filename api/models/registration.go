@@ -0,0 +1,397 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"NemWebGoApi/internal/metrics"
+	"NemWebGoApi/internal/xlsx"
+)
+
+// RegistrationSheets are the names AEMO has given the sheet of the NEM Registration and Exemption List
+// holding generating units, newest first
+var RegistrationSheets = []string{"PU and Scheduled Loads", "Generators and Scheduled Loads"}
+
+// registrationHeaderRows is how far down a sheet the header row is looked for, AEMO's files
+// sometimes have a title above it
+const registrationHeaderRows = 10
+
+// registrationColumns are the headers mapped onto each unit field, normalised by registrationHeader,
+// the first present is used, rows without a maximum capacity fall back to the registered capacity
+var registrationColumns = []struct {
+	field   string
+	headers []string
+}{
+	{"duid", []string{"duid"}},
+	{"station_name", []string{"station name"}},
+	{"region_id", []string{"region", "region id"}},
+	{"fuel_source", []string{"fuel source primary", "fuel source"}},
+	{"technology_type", []string{"technology type primary", "technology type"}},
+	{"max_capacity", []string{"max cap mw", "max capacity"}},
+	{"reg_capacity", []string{"reg cap mw", "reg cap generation mw", "registered capacity"}},
+}
+
+// Actions in a registration import diff
+const (
+	RegistrationInsert    = "insert"
+	RegistrationUpdate    = "update"
+	RegistrationUnchanged = "unchanged"
+	RegistrationConflict  = "conflict"
+	RegistrationInvalid   = "invalid"
+)
+
+// ErrInvalidRegistration is returned when a registration list cannot be read
+var ErrInvalidRegistration = errors.New("invalid registration list")
+
+// RegistrationRow is a unit read from the registration list, HasCapacity is false when the
+// list has no capacity for it so the current capacity is kept
+type RegistrationRow struct {
+	Line        int
+	Unit        Unit
+	HasCapacity bool
+}
+
+// FieldChange is the current and imported value of a changed field
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// RegistrationChange is what importing a DUID would do, Lines are the rows it was read from
+type RegistrationChange struct {
+	DuID    string                 `json:"duid"`
+	Action  string                 `json:"action"`
+	Lines   []int                  `json:"lines"`
+	Changes map[string]FieldChange `json:"changes,omitempty"`
+	Problem string                 `json:"problem,omitempty"`
+}
+
+// RegistrationImport is the diff of a registration list against the units table, Changes
+// leaves out unchanged units, Applied is set once the inserts and updates are committed
+type RegistrationImport struct {
+	Applied   bool                 `json:"applied"`
+	Inserted  int                  `json:"inserted"`
+	Updated   int                  `json:"updated"`
+	Unchanged int                  `json:"unchanged"`
+	Conflicts int                  `json:"conflicts"`
+	Invalid   int                  `json:"invalid"`
+	Changes   []RegistrationChange `json:"changes"`
+}
+
+// ParseRegistration reads the registration list from an XLSX workbook, recognised by its zip
+// signature, or CSV export, sheet selects the workbook sheet as in ParseRegistrationXLSX
+func ParseRegistration(data []byte, sheet string) ([]RegistrationRow, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return ParseRegistrationXLSX(bytes.NewReader(data), int64(len(data)), sheet)
+	}
+	return ParseRegistrationCSV(bytes.NewReader(data))
+}
+
+// ParseRegistrationCSV reads units from a CSV export of the registration list
+func ParseRegistrationCSV(r io.Reader) ([]RegistrationRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("models.ParseRegistrationCSV: %w: %v", ErrInvalidRegistration, err)
+	}
+	rows, err := parseRegistrationRows(records)
+	if err != nil {
+		return nil, fmt.Errorf("models.ParseRegistrationCSV: %w", err)
+	}
+	return rows, nil
+}
+
+// ParseRegistrationXLSX reads units from a sheet of the registration list workbook, if sheet is empty
+// one of RegistrationSheets if the workbook has it, otherwise the first sheet with a DUID column
+func ParseRegistrationXLSX(r io.ReaderAt, size int64, sheet string) ([]RegistrationRow, error) {
+	wb, err := xlsx.Open(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("models.ParseRegistrationXLSX: %w: %v", ErrInvalidRegistration, err)
+	}
+
+	names := wb.Sheets()
+	if sheet != "" {
+		names = []string{sheet}
+	} else {
+		for _, name := range RegistrationSheets {
+			if containsString(names, name) {
+				names = []string{name}
+				break
+			}
+		}
+	}
+	for _, name := range names {
+		records, err := wb.Rows(name)
+		if err != nil {
+			return nil, fmt.Errorf("models.ParseRegistrationXLSX: %w: %v", ErrInvalidRegistration, err)
+		}
+		rows, err := parseRegistrationRows(records)
+		if err == nil {
+			return rows, nil
+		}
+		if sheet != "" || len(names) == 1 {
+			return nil, fmt.Errorf("models.ParseRegistrationXLSX: sheet %s: %w", name, err)
+		}
+	}
+	return nil, fmt.Errorf("models.ParseRegistrationXLSX: %w: no sheet has a DUID column", ErrInvalidRegistration)
+}
+
+// parseRegistrationRows maps records onto units using the header row, rows without a DUID,
+// which AEMO marks "-" for exempt and aggregated plant, are skipped
+func parseRegistrationRows(records [][]string) ([]RegistrationRow, error) {
+	headerRow := -1
+	columns := make(map[string]int)
+	for i := 0; i < len(records) && i < registrationHeaderRows; i++ {
+		found := make(map[string]int)
+		for j, cell := range records[i] {
+			if _, ok := found[registrationHeader(cell)]; !ok {
+				found[registrationHeader(cell)] = j
+			}
+		}
+		if _, ok := found["duid"]; !ok {
+			continue
+		}
+		headerRow = i
+		for _, column := range registrationColumns {
+			for _, header := range column.headers {
+				if j, ok := found[header]; ok {
+					columns[column.field] = j
+					break
+				}
+			}
+		}
+		break
+	}
+	if headerRow < 0 {
+		return nil, fmt.Errorf("%w: no DUID header in the first %d rows", ErrInvalidRegistration, registrationHeaderRows)
+	}
+	for _, column := range registrationColumns {
+		if _, ok := columns[column.field]; !ok && column.field != "max_capacity" && column.field != "reg_capacity" {
+			return nil, fmt.Errorf("%w: missing %s column", ErrInvalidRegistration, column.headers[0])
+		}
+	}
+
+	value := func(record []string, field string) string {
+		j, ok := columns[field]
+		if !ok || j >= len(record) {
+			return ""
+		}
+		v := strings.TrimSpace(record[j])
+		if v == "-" {
+			return ""
+		}
+		return v
+	}
+
+	rows := make([]RegistrationRow, 0, len(records)-headerRow-1)
+	for i := headerRow + 1; i < len(records); i++ {
+		record := records[i]
+		duid := strings.ToUpper(value(record, "duid"))
+		if duid == "" {
+			continue
+		}
+		row := RegistrationRow{
+			Line: i + 1,
+			Unit: Unit{
+				DuID:           duid,
+				StationName:    value(record, "station_name"),
+				RegionID:       strings.ToUpper(value(record, "region_id")),
+				FuelSource:     value(record, "fuel_source"),
+				TechnologyType: value(record, "technology_type"),
+			},
+		}
+		for _, field := range []string{"max_capacity", "reg_capacity"} {
+			if capacity, err := strconv.ParseFloat(value(record, field), 64); err == nil {
+				row.Unit.MaxCapacity, row.HasCapacity = int64(math.Round(capacity)), true
+				break
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// registrationHeader lower cases a header and reduces it to words, so "Fuel Source - Primary"
+// becomes "fuel source primary" and "Max Cap (MW)" becomes "max cap mw"
+func registrationHeader(s string) string {
+	return strings.Join(searchTokens(s), " ")
+}
+
+// ImportRegistration diffs rows against the units table, with apply the inserts and updates are
+// written in one transaction with a unit_history record each, otherwise nothing is written
+// DUIDs listed more than once with different values are conflicts and, like rows that fail
+// validation, are reported and left alone, existing locations and units missing from the list are kept
+func ImportRegistration(ctx context.Context, db *sql.DB, rows []RegistrationRow, apply bool, actor string) (*RegistrationImport, error) {
+	ctx, done := startQuery(ctx, metrics.StoreSQLite, "units", "models.ImportRegistration")
+	result, err := importRegistration(ctx, db, rows, apply, actor)
+	if err != nil {
+		done(0, err)
+		return nil, err
+	}
+	done(len(rows), nil)
+	return result, nil
+}
+
+func importRegistration(ctx context.Context, db *sql.DB, rows []RegistrationRow, apply bool, actor string) (*RegistrationImport, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("models.ImportRegistration: begin error: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := readUnitsTx(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	byDUID := make(map[string][]RegistrationRow)
+	duids := make([]string, 0)
+	for _, row := range rows {
+		if _, ok := byDUID[row.Unit.DuID]; !ok {
+			duids = append(duids, row.Unit.DuID)
+		}
+		byDUID[row.Unit.DuID] = append(byDUID[row.Unit.DuID], row)
+	}
+	sort.Strings(duids)
+
+	result := &RegistrationImport{Changes: make([]RegistrationChange, 0)}
+	for _, duid := range duids {
+		listed := byDUID[duid]
+		change := RegistrationChange{DuID: duid, Action: RegistrationUnchanged}
+		for _, row := range listed {
+			change.Lines = append(change.Lines, row.Line)
+		}
+
+		row, conflicts := mergeRegistrationRows(listed)
+		existing, exists := current[duid]
+		unit := row.Unit
+		if exists {
+			unit.ID, unit.Latitude, unit.Longitude, unit.State = existing.ID, existing.Latitude, existing.Longitude, existing.State
+			if !row.HasCapacity {
+				unit.MaxCapacity = existing.MaxCapacity
+			}
+		}
+
+		var invalid *UnitValidationError
+		switch err := unit.Validate(); {
+		case len(conflicts) > 0:
+			change.Action = RegistrationConflict
+			change.Problem = "listed with different " + strings.Join(conflicts, ", ")
+			result.Conflicts++
+		case errors.As(err, &invalid):
+			change.Action, change.Problem = RegistrationInvalid, invalid.Error()
+			result.Invalid++
+		case !exists:
+			change.Action = RegistrationInsert
+			change.Changes = unitChanges(Unit{}, unit)
+			result.Inserted++
+		default:
+			change.Changes = unitChanges(existing, unit)
+			if len(change.Changes) == 0 {
+				result.Unchanged++
+				continue
+			}
+			change.Action = RegistrationUpdate
+			result.Updated++
+		}
+		result.Changes = append(result.Changes, change)
+
+		if !apply || (change.Action != RegistrationInsert && change.Action != RegistrationUpdate) {
+			continue
+		}
+		err := writeUnitTx(ctx, tx, "models.ImportRegistration", duid, actor, func(tx *sql.Tx, _ *Unit) (*Unit, string, error) {
+			if change.Action == RegistrationInsert {
+				return &unit, UnitCreated, insertUnitRow(ctx, tx, unit)
+			}
+			return &unit, UnitUpdated, updateUnitRow(ctx, tx, unit)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !apply {
+		return result, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("models.ImportRegistration: commit error: %w", err)
+	}
+	unitCache.Purge()
+	result.Applied = true
+	return result, nil
+}
+
+// mergeRegistrationRows combines the rows listing a DUID, returning the fields they disagree on,
+// a capacity given by only some rows is not a disagreement
+func mergeRegistrationRows(rows []RegistrationRow) (RegistrationRow, []string) {
+	merged := rows[0]
+	conflicts := make([]string, 0)
+	for _, row := range rows[1:] {
+		for field := range unitChanges(merged.Unit, row.Unit) {
+			if field == "max_capacity" && !(merged.HasCapacity && row.HasCapacity) {
+				continue
+			}
+			if !containsString(conflicts, field) {
+				conflicts = append(conflicts, field)
+			}
+		}
+		if !merged.HasCapacity && row.HasCapacity {
+			merged.Unit.MaxCapacity, merged.HasCapacity = row.Unit.MaxCapacity, true
+		}
+	}
+	sort.Strings(conflicts)
+	return merged, conflicts
+}
+
+// unitChanges returns the registration fields that differ between two units
+func unitChanges(from Unit, to Unit) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+	for _, field := range []struct {
+		name     string
+		from, to interface{}
+	}{
+		{"station_name", from.StationName, to.StationName},
+		{"region_id", from.RegionID, to.RegionID},
+		{"fuel_source", from.FuelSource, to.FuelSource},
+		{"technology_type", from.TechnologyType, to.TechnologyType},
+		{"max_capacity", from.MaxCapacity, to.MaxCapacity},
+	} {
+		if field.from != field.to {
+			changes[field.name] = FieldChange{From: field.from, To: field.to}
+		}
+	}
+	return changes
+}
+
+// readUnitsTx returns every unit keyed by DUID as seen by tx
+func readUnitsTx(ctx context.Context, tx *sql.Tx) (map[string]Unit, error) {
+	results, err := tx.QueryContext(ctx, "SELECT "+unitColumns+" FROM units")
+	if err != nil {
+		return nil, fmt.Errorf("models.ImportRegistration: query error: %w", err)
+	}
+	defer results.Close()
+
+	units := make(map[string]Unit)
+	for results.Next() {
+		unit, err := scanUnit(results)
+		if err != nil {
+			return nil, fmt.Errorf("models.ImportRegistration: scan error: %w", err)
+		}
+		units[unit.DuID] = *unit
+	}
+	if err := results.Err(); err != nil {
+		return nil, fmt.Errorf("models.ImportRegistration: query parsing error: %w", err)
+	}
+	return units, nil
+}
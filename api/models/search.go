@@ -0,0 +1,293 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"NemWebGoApi/internal/metrics"
+)
+
+const (
+	// DefaultSearchLimit is the number of units and of stations returned when no limit is given
+	DefaultSearchLimit = 10
+	// MaxSearchLimit is the largest limit accepted
+	MaxSearchLimit = 50
+)
+
+// searchFTS is set when the units_search FTS5 index is available
+var searchFTS int32
+
+// SetSearchIndex sets whether Search can use the units_search FTS5 index,
+// without it every match is found by fuzzy matching in Go
+func SetSearchIndex(available bool) {
+	if available {
+		atomic.StoreInt32(&searchFTS, 1)
+	} else {
+		atomic.StoreInt32(&searchFTS, 0)
+	}
+}
+
+// UnitMatch is a unit found by Search
+type UnitMatch struct {
+	UnitView
+	Score float64 `json:"score"` // 0 to 1, 1 for an exact match of every term
+}
+
+// StationMatch is a station found by Search
+type StationMatch struct {
+	Station
+	Score float64 `json:"score"`
+}
+
+// SearchResults are the units and stations matching a search, best first
+type SearchResults struct {
+	Query    string         `json:"query"`
+	Units    []UnitMatch    `json:"units"`
+	Stations []StationMatch `json:"stations"`
+}
+
+// searchWeights weight where a term matched, a DUID match ranks above a station name
+// match which ranks above a fuel or technology match
+var searchWeights = struct{ duid, station, other float64 }{1, 0.9, 0.6}
+
+// Search finds units and stations matching every term of q, terms match whole words,
+// prefixes for autocomplete, or words within a small edit distance for typos
+// Prefix matches are found and ranked with the FTS5 index when available, with typo
+// tolerant matches after them
+func Search(ctx context.Context, db *sql.DB, q string, limit int) (SearchResults, error) {
+	results := SearchResults{Query: q, Units: make([]UnitMatch, 0), Stations: make([]StationMatch, 0)}
+	terms := searchTokens(q)
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	unit := Unit{}
+	all, err := unit.ReadAll(ctx, db, ParseUnitFilterMap(map[string][]string{}))
+	if err != nil {
+		return results, fmt.Errorf("models.Search: %w", err)
+	}
+
+	// Rank of each unit in the FTS5 results, units it found are listed first
+	ranked := make(map[int64]int)
+	if atomic.LoadInt32(&searchFTS) == 1 {
+		ids, err := searchIndex(ctx, db, terms, MaxSearchLimit)
+		if err != nil {
+			return results, err
+		}
+		for i, id := range ids {
+			ranked[id] = i
+		}
+	}
+
+	for _, u := range *all {
+		score := scoreUnit(terms, u)
+		if _, ok := ranked[u.ID]; !ok && score == 0 {
+			continue
+		}
+		results.Units = append(results.Units, UnitMatch{UnitView: u.View(), Score: roundScore(score)})
+	}
+	sort.SliceStable(results.Units, func(i, j int) bool {
+		ri, iok := ranked[results.Units[i].ID]
+		rj, jok := ranked[results.Units[j].ID]
+		if iok != jok {
+			return iok
+		}
+		if iok && ri != rj {
+			return ri < rj
+		}
+		if results.Units[i].Score != results.Units[j].Score {
+			return results.Units[i].Score > results.Units[j].Score
+		}
+		return results.Units[i].DuID < results.Units[j].DuID
+	})
+	if len(results.Units) > limit {
+		results.Units = results.Units[:limit]
+	}
+
+	for name, members := range GroupUnitsByStation(*all) {
+		if score := scoreTerms(terms, searchTokens(name)); score > 0 {
+			results.Stations = append(results.Stations, StationMatch{Station: NewStation(name, members), Score: roundScore(score * searchWeights.station)})
+		}
+	}
+	sort.Slice(results.Stations, func(i, j int) bool {
+		if results.Stations[i].Score != results.Stations[j].Score {
+			return results.Stations[i].Score > results.Stations[j].Score
+		}
+		return results.Stations[i].StationName < results.Stations[j].StationName
+	})
+	if len(results.Stations) > limit {
+		results.Stations = results.Stations[:limit]
+	}
+
+	return results, nil
+}
+
+// searchIndex returns the rowids of units with every term as a prefix of a word, best first
+// by bm25 weighted towards DUID and station name matches
+func searchIndex(ctx context.Context, db *sql.DB, terms []string, limit int) ([]int64, error) {
+	match := make([]string, 0, len(terms))
+	for _, term := range terms {
+		match = append(match, `"`+term+`"*`)
+	}
+	query := "SELECT rowid FROM units_search WHERE units_search MATCH ? ORDER BY bm25(units_search, 10.0, 5.0, 1.0, 1.0) LIMIT ?"
+
+	ctx, done := startQuery(ctx, metrics.StoreSQLite, "units_search", query)
+	results, err := db.QueryContext(ctx, query, strings.Join(match, " AND "), limit)
+	if err != nil {
+		done(0, err)
+		return nil, fmt.Errorf("models.Search: query error: %w", err)
+	}
+	defer results.Close()
+
+	ids := make([]int64, 0)
+	for results.Next() {
+		var id int64
+		if err := results.Scan(&id); err != nil {
+			done(0, err)
+			return nil, fmt.Errorf("models.Search: scan error: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := results.Err(); err != nil {
+		done(0, err)
+		return nil, fmt.Errorf("models.Search: query parsing error: %w", err)
+	}
+	done(len(ids), nil)
+	return ids, nil
+}
+
+// scoreUnit scores each term against the best matching field of the unit, 0 if any term does not match
+func scoreUnit(terms []string, u Unit) float64 {
+	fields := []struct {
+		words  []string
+		weight float64
+	}{
+		{searchTokens(u.DuID), searchWeights.duid},
+		{searchTokens(u.StationName), searchWeights.station},
+		{searchTokens(u.FuelSource), searchWeights.other},
+		{searchTokens(u.TechnologyType), searchWeights.other},
+	}
+
+	total := 0.0
+	for _, term := range terms {
+		best := 0.0
+		for _, field := range fields {
+			if score := scoreTerm(term, field.words) * field.weight; score > best {
+				best = score
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		total += best
+	}
+	return total / float64(len(terms))
+}
+
+// scoreTerms is the mean score of the terms against words, 0 if any term does not match
+func scoreTerms(terms []string, words []string) float64 {
+	total := 0.0
+	for _, term := range terms {
+		score := scoreTerm(term, words)
+		if score == 0 {
+			return 0
+		}
+		total += score
+	}
+	return total / float64(len(terms))
+}
+
+// scoreTerm scores the best match of term against words, 1 for an exact word, 0.9 for
+// a prefix, 0.7 for a substring and less for each edit needed to correct a typo
+func scoreTerm(term string, words []string) float64 {
+	best := 0.0
+	for _, word := range words {
+		score := 0.0
+		switch {
+		case word == term:
+			score = 1
+		case strings.HasPrefix(word, term):
+			score = 0.9
+		case len(term) >= 3 && strings.Contains(word, term):
+			score = 0.7
+		default:
+			// Compare against the word's prefix of the same length too, so typos in a prefix still match
+			distance := editDistance(term, word)
+			if rw, rt := []rune(word), []rune(term); len(rw) > len(rt) {
+				if d := editDistance(term, string(rw[:len(rt)])); d < distance {
+					distance = d
+				}
+			}
+			if distance <= maxEdits(term) {
+				score = 0.6 - 0.1*float64(distance)
+			}
+		}
+		if score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+// maxEdits is the typo tolerance for a term, short terms must match exactly
+func maxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance is the Damerau-Levenshtein (optimal string alignment) distance between a and b
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	rows := make([][]int, len(ra)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			rows[i][j] = minInt(rows[i-1][j]+1, minInt(rows[i][j-1]+1, rows[i-1][j-1]+cost))
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				rows[i][j] = minInt(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(ra)][len(rb)]
+}
+
+// searchTokens lower cases s and splits it into words of letters and digits
+func searchTokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func roundScore(score float64) float64 {
+	return math.Round(score*1000) / 1000
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
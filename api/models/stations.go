@@ -0,0 +1,90 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/influxdata/influxdb-client-go/v2/api"
+)
+
+// Station is a power station made up of the units sharing its station_name
+type Station struct {
+	StationName string   `json:"station_name"`
+	RegionID    string   `json:"region_id"`
+	MaxCapacity int64    `json:"max_capacity"` // sum of the member units' max capacity
+	Units       []string `json:"units"`
+}
+
+// StationGenerationDataPoint is a station's generation summed over its member units per interval
+type StationGenerationDataPoint struct {
+	Station
+	Data []DataPoint `json:"data"`
+}
+
+// ReadStations returns the stations of the units matching filter, ordered by name
+func ReadStations(ctx context.Context, db *sql.DB, filter UnitFilter) ([]Station, error) {
+	unit := Unit{}
+	units, err := unit.ReadAll(ctx, db, filter)
+	if err != nil {
+		return []Station{}, fmt.Errorf("models.ReadStations: %w", err)
+	}
+
+	groups := GroupUnitsByStation(*units)
+	stations := make([]Station, 0, len(groups))
+	for name, members := range groups {
+		stations = append(stations, NewStation(name, members))
+	}
+	sort.Slice(stations, func(i, j int) bool { return stations[i].StationName < stations[j].StationName })
+	return stations, nil
+}
+
+// GroupUnitsByStation groups units by station name, units without one are left out
+func GroupUnitsByStation(units []Unit) map[string][]Unit {
+	groups := make(map[string][]Unit)
+	for _, unit := range units {
+		if unit.StationName == "" {
+			continue
+		}
+		groups[unit.StationName] = append(groups[unit.StationName], unit)
+	}
+	return groups
+}
+
+// NewStation builds a station from its member units
+func NewStation(name string, units []Unit) Station {
+	station := Station{StationName: name, Units: make([]string, 0, len(units))}
+	for _, unit := range units {
+		station.Units = append(station.Units, unit.DuID)
+		station.MaxCapacity += unit.MaxCapacity
+		if station.RegionID == "" {
+			station.RegionID = unit.RegionID
+		}
+	}
+	sort.Strings(station.Units)
+	return station
+}
+
+// ReadStationGenerationData returns the generation of each station of units, summing its member units per interval
+func ReadStationGenerationData(ctx context.Context, db api.QueryAPI, bucket string, filter GeneratorGroupedFilter, units []Unit) ([]StationGenerationDataPoint, error) {
+	groups := GroupUnitsByStation(units)
+	data := make([]StationGenerationDataPoint, 0, len(groups))
+	if len(groups) == 0 {
+		return data, nil
+	}
+
+	series, err := ReadGroupedGenerationData(ctx, db, bucket, filter, groups)
+	if err != nil {
+		return []StationGenerationDataPoint{}, fmt.Errorf("models.ReadStationGenerationData: %w", err)
+	}
+
+	for _, s := range series {
+		data = append(data, StationGenerationDataPoint{
+			Station: NewStation(s.Unit, groups[s.Unit]),
+			Data:    s.Data,
+		})
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].StationName < data[j].StationName })
+	return data, nil
+}
@@ -0,0 +1,460 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"NemWebGoApi/internal/metrics"
+)
+
+// Errors returned by unit writes
+var (
+	ErrUnitNotFound           = errors.New("unit not found")
+	ErrUnitExists             = errors.New("unit already exists")
+	ErrUnitPreconditionFailed = errors.New("unit has changed, etag does not match")
+)
+
+// NEMRegions are the region ids a unit may belong to
+var NEMRegions = []string{"NSW1", "QLD1", "SA1", "TAS1", "VIC1"}
+
+// AustralianStates are the states and territories a unit may be located in
+var AustralianStates = []string{"ACT", "NSW", "NT", "QLD", "SA", "TAS", "VIC", "WA"}
+
+// Unit history actions
+const (
+	UnitCreated = "create"
+	UnitUpdated = "update"
+	UnitDeleted = "delete"
+)
+
+var validDUID = regexp.MustCompile(`^[A-Za-z0-9_]{1,32}$`)
+
+// UnitValidationError lists the invalid fields of a unit and why
+type UnitValidationError struct {
+	Fields map[string]string
+}
+
+func (e *UnitValidationError) Error() string {
+	problems := make([]string, 0, len(e.Fields))
+	for field, problem := range e.Fields {
+		problems = append(problems, field+" "+problem)
+	}
+	sort.Strings(problems)
+	return "invalid unit: " + strings.Join(problems, ", ")
+}
+
+// UnitPatch holds the unit fields to change, nil fields are left as they are
+type UnitPatch struct {
+	StationName    *string  `json:"station_name"`
+	RegionID       *string  `json:"region_id"`
+	FuelSource     *string  `json:"fuel_source"`
+	TechnologyType *string  `json:"technology_type"`
+	MaxCapacity    *int64   `json:"max_capacity"`
+	Latitude       *float64 `json:"latitude"`
+	Longitude      *float64 `json:"longitude"`
+	State          *string  `json:"state"`
+}
+
+// UnitChange is a row of the unit_history table
+type UnitChange struct {
+	ID        int64     `json:"id"`
+	DuID      string    `json:"duid"`
+	Action    string    `json:"action"`
+	ChangedBy string    `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+	Before    *Unit     `json:"before"`
+	After     *Unit     `json:"after"`
+}
+
+// Validate checks the unit can be written, returning a *UnitValidationError if not
+func (u *Unit) Validate() error {
+	fields := make(map[string]string)
+	if !validDUID.MatchString(u.DuID) {
+		fields["duid"] = "must be 1 to 32 letters, digits or underscores"
+	}
+	if strings.TrimSpace(u.StationName) == "" {
+		fields["station_name"] = "is required"
+	}
+	if !containsString(NEMRegions, u.RegionID) {
+		fields["region_id"] = "must be one of " + strings.Join(NEMRegions, ", ")
+	}
+	if strings.TrimSpace(u.FuelSource) == "" {
+		fields["fuel_source"] = "is required"
+	}
+	if strings.TrimSpace(u.TechnologyType) == "" {
+		fields["technology_type"] = "is required"
+	}
+	if u.MaxCapacity < 0 {
+		fields["max_capacity"] = "must not be negative"
+	}
+	if (u.Latitude == nil) != (u.Longitude == nil) {
+		fields["location"] = "latitude and longitude must be given together"
+	}
+	if u.Latitude != nil && (*u.Latitude < -90 || *u.Latitude > 90) {
+		fields["latitude"] = "must be between -90 and 90"
+	}
+	if u.Longitude != nil && (*u.Longitude < -180 || *u.Longitude > 180) {
+		fields["longitude"] = "must be between -180 and 180"
+	}
+	if u.State != "" && !containsString(AustralianStates, u.State) {
+		fields["state"] = "must be one of " + strings.Join(AustralianStates, ", ")
+	}
+	if len(fields) > 0 {
+		return &UnitValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// ETag returns a strong entity tag for the unit's current values
+func (u *Unit) ETag() string {
+	values := []string{u.DuID, u.StationName, u.RegionID, u.FuelSource, u.TechnologyType, fmt.Sprint(u.MaxCapacity)}
+	// Location is only included once set, so units without one keep the ETags they had before it existed
+	if u.Latitude != nil || u.Longitude != nil || u.State != "" {
+		values = append(values, formatCoordinate(u.Latitude), formatCoordinate(u.Longitude), u.State)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(values, "\x00")))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// MatchesETag returns true if an If-Match header value matches the unit, "*" matches any unit
+func (u *Unit) MatchesETag(ifMatch string) bool {
+	etag := u.ETag()
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns a copy of the unit with the patch applied
+func (p UnitPatch) Apply(u Unit) Unit {
+	if p.StationName != nil {
+		u.StationName = *p.StationName
+	}
+	if p.RegionID != nil {
+		u.RegionID = *p.RegionID
+	}
+	if p.FuelSource != nil {
+		u.FuelSource = *p.FuelSource
+	}
+	if p.TechnologyType != nil {
+		u.TechnologyType = *p.TechnologyType
+	}
+	if p.MaxCapacity != nil {
+		u.MaxCapacity = *p.MaxCapacity
+	}
+	if p.Latitude != nil {
+		u.Latitude = p.Latitude
+	}
+	if p.Longitude != nil {
+		u.Longitude = p.Longitude
+	}
+	if p.State != nil {
+		u.State = *p.State
+	}
+	return u
+}
+
+// ReadUnit returns the unit with the DUID, ErrUnitNotFound if there is none
+func ReadUnit(ctx context.Context, db *sql.DB, duid string) (*Unit, error) {
+	query := "SELECT " + unitColumns + " FROM units WHERE duid = ?"
+	ctx, done := startQuery(ctx, metrics.StoreSQLite, "units", query)
+	unit, err := scanUnit(db.QueryRowContext(ctx, query, duid))
+	if err == sql.ErrNoRows {
+		done(0, nil)
+		return nil, ErrUnitNotFound
+	}
+	done(1, err)
+	if err != nil {
+		return nil, fmt.Errorf("models.ReadUnit: query error: %w", err)
+	}
+	return unit, nil
+}
+
+// CreateUnit inserts a new unit, ErrUnitExists if the DUID is taken
+func CreateUnit(ctx context.Context, db *sql.DB, unit Unit, actor string) (*Unit, error) {
+	if err := unit.Validate(); err != nil {
+		return nil, err
+	}
+
+	err := writeUnit(ctx, db, "models.CreateUnit", unit.DuID, actor, func(tx *sql.Tx, current *Unit) (*Unit, string, error) {
+		if current != nil {
+			return nil, "", ErrUnitExists
+		}
+		return &unit, UnitCreated, insertUnitRow(ctx, tx, unit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &unit, nil
+}
+
+// UpdateUnit replaces the unit with the DUID, if ifMatch is set it must match the current ETag
+func UpdateUnit(ctx context.Context, db *sql.DB, duid string, unit Unit, ifMatch string, actor string) (*Unit, error) {
+	unit.DuID = duid
+	if err := unit.Validate(); err != nil {
+		return nil, err
+	}
+	return replaceUnit(ctx, db, "models.UpdateUnit", duid, ifMatch, actor, func(Unit) Unit { return unit })
+}
+
+// PatchUnit changes the given fields of the unit with the DUID, if ifMatch is set it must match the current ETag
+func PatchUnit(ctx context.Context, db *sql.DB, duid string, patch UnitPatch, ifMatch string, actor string) (*Unit, error) {
+	return replaceUnit(ctx, db, "models.PatchUnit", duid, ifMatch, actor, patch.Apply)
+}
+
+// DeleteUnit removes the unit with the DUID, if ifMatch is set it must match the current ETag
+func DeleteUnit(ctx context.Context, db *sql.DB, duid string, ifMatch string, actor string) error {
+	return writeUnit(ctx, db, "models.DeleteUnit", duid, actor, func(tx *sql.Tx, current *Unit) (*Unit, string, error) {
+		if current == nil {
+			return nil, "", ErrUnitNotFound
+		}
+		if ifMatch != "" && !current.MatchesETag(ifMatch) {
+			return nil, "", ErrUnitPreconditionFailed
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM units WHERE duid = ?", duid)
+		return nil, UnitDeleted, err
+	})
+}
+
+func replaceUnit(ctx context.Context, db *sql.DB, caller string, duid string, ifMatch string, actor string, change func(Unit) Unit) (*Unit, error) {
+	var updated Unit
+	err := writeUnit(ctx, db, caller, duid, actor, func(tx *sql.Tx, current *Unit) (*Unit, string, error) {
+		if current == nil {
+			return nil, "", ErrUnitNotFound
+		}
+		if ifMatch != "" && !current.MatchesETag(ifMatch) {
+			return nil, "", ErrUnitPreconditionFailed
+		}
+		updated = change(*current)
+		updated.DuID = duid
+		if err := updated.Validate(); err != nil {
+			return nil, "", err
+		}
+		return &updated, UnitUpdated, updateUnitRow(ctx, tx, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// unitWrite changes a unit inside a transaction given its current value, nil if it does not exist,
+// returning the new value, nil if deleted, and the history action
+type unitWrite func(tx *sql.Tx, current *Unit) (*Unit, string, error)
+
+// writeUnit runs write in a transaction with a unit_history record of the change,
+// purging the unit cache once committed so ReadAll sees the change
+func writeUnit(ctx context.Context, db *sql.DB, caller string, duid string, actor string, write unitWrite) (err error) {
+	ctx, done := startQuery(ctx, metrics.StoreSQLite, "units", caller)
+	defer func() {
+		if errors.Is(err, ErrUnitNotFound) || errors.Is(err, ErrUnitExists) || errors.Is(err, ErrUnitPreconditionFailed) {
+			done(0, nil)
+		} else {
+			done(1, err)
+		}
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin error: %w", caller, err)
+	}
+	defer tx.Rollback()
+
+	if err := writeUnitTx(ctx, tx, caller, duid, actor, write); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit error: %w", caller, err)
+	}
+	unitCache.Purge()
+	return nil
+}
+
+// writeUnitTx runs write and records it in unit_history within tx, so several units
+// can be written in one transaction, the caller commits and purges the unit cache
+func writeUnitTx(ctx context.Context, tx *sql.Tx, caller string, duid string, actor string, write unitWrite) error {
+	current, err := scanUnit(tx.QueryRowContext(ctx,
+		"SELECT "+unitColumns+" FROM units WHERE duid = ?", duid))
+	if err == sql.ErrNoRows {
+		current, err = nil, nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: query error: %w", caller, err)
+	}
+
+	after, action, err := write(tx, current)
+	if err != nil {
+		var invalid *UnitValidationError
+		if errors.Is(err, ErrUnitNotFound) || errors.Is(err, ErrUnitExists) || errors.Is(err, ErrUnitPreconditionFailed) || errors.As(err, &invalid) {
+			return err
+		}
+		return fmt.Errorf("%s: exec error: %w", caller, err)
+	}
+
+	before, err := unitJSON(current)
+	if err != nil {
+		return fmt.Errorf("%s: %w", caller, err)
+	}
+	afterJSON, err := unitJSON(after)
+	if err != nil {
+		return fmt.Errorf("%s: %w", caller, err)
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO unit_history (duid, action, changed_by, changed_at, before, after) VALUES (?, ?, ?, ?, ?, ?)",
+		duid, action, actor, time.Now().UTC(), before, afterJSON,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: history error: %w", caller, err)
+	}
+	return nil
+}
+
+func insertUnitRow(ctx context.Context, tx *sql.Tx, u Unit) error {
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO units (duid, station_name, region_id, fuel_source, technology_type, max_capacity, latitude, longitude, state) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		u.DuID, u.StationName, u.RegionID, u.FuelSource, u.TechnologyType, u.MaxCapacity, u.Latitude, u.Longitude, nullString(u.State),
+	)
+	return err
+}
+
+func updateUnitRow(ctx context.Context, tx *sql.Tx, u Unit) error {
+	_, err := tx.ExecContext(ctx,
+		"UPDATE units SET station_name = ?, region_id = ?, fuel_source = ?, technology_type = ?, max_capacity = ?, latitude = ?, longitude = ?, state = ? WHERE duid = ?",
+		u.StationName, u.RegionID, u.FuelSource, u.TechnologyType, u.MaxCapacity, u.Latitude, u.Longitude, nullString(u.State), u.DuID,
+	)
+	return err
+}
+
+// ReadUnitHistory returns the recorded changes to a unit, newest first
+func ReadUnitHistory(ctx context.Context, db *sql.DB, duid string) ([]UnitChange, error) {
+	query := "SELECT id, duid, action, changed_by, changed_at, before, after FROM unit_history WHERE duid = ? ORDER BY changed_at DESC, id DESC"
+	ctx, done := startQuery(ctx, metrics.StoreSQLite, "unit_history", query)
+	results, err := db.QueryContext(ctx, query, duid)
+	if err != nil {
+		done(0, err)
+		return []UnitChange{}, fmt.Errorf("models.ReadUnitHistory: query error: %w", err)
+	}
+	defer results.Close()
+
+	changes := make([]UnitChange, 0)
+	for results.Next() {
+		var change UnitChange
+		var before, after sql.NullString
+		if err := results.Scan(&change.ID, &change.DuID, &change.Action, &change.ChangedBy, &change.ChangedAt, &before, &after); err != nil {
+			done(0, err)
+			return []UnitChange{}, fmt.Errorf("models.ReadUnitHistory: scan error: %w", err)
+		}
+		if change.Before, err = parseUnitJSON(before); err != nil {
+			done(0, err)
+			return []UnitChange{}, fmt.Errorf("models.ReadUnitHistory: %w", err)
+		}
+		if change.After, err = parseUnitJSON(after); err != nil {
+			done(0, err)
+			return []UnitChange{}, fmt.Errorf("models.ReadUnitHistory: %w", err)
+		}
+		changes = append(changes, change)
+	}
+	if err := results.Err(); err != nil {
+		done(0, err)
+		return []UnitChange{}, fmt.Errorf("models.ReadUnitHistory: query parsing error: %w", err)
+	}
+	done(len(changes), nil)
+	return changes, nil
+}
+
+// scanUnit scans unitColumns, NULLs left by the scraper are read as empty values
+func scanUnit(row rowScanner) (*Unit, error) {
+	var unit Unit
+	var stationName, regionID, fuelSource, technologyType, state sql.NullString
+	var maxCapacity sql.NullInt64
+	var latitude, longitude sql.NullFloat64
+	if err := row.Scan(&unit.ID, &unit.DuID, &stationName, &regionID, &fuelSource, &technologyType, &maxCapacity, &latitude, &longitude, &state); err != nil {
+		return nil, err
+	}
+	if latitude.Valid && longitude.Valid {
+		unit.Latitude, unit.Longitude = &latitude.Float64, &longitude.Float64
+	}
+	unit.State = state.String
+	unit.StationName = stationName.String
+	unit.RegionID = regionID.String
+	unit.FuelSource = fuelSource.String
+	unit.TechnologyType = technologyType.String
+	unit.MaxCapacity = maxCapacity.Int64
+	return &unit, nil
+}
+
+// unitJSON encodes a unit for unit_history in version 2 of the response schema
+func unitJSON(u *Unit) (sql.NullString, error) {
+	if u == nil {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(u.View())
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("history encoding error: %w", err)
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+// parseUnitJSON decodes a unit_history unit, accepting the staion_name key written by earlier versions
+func parseUnitJSON(s sql.NullString) (*Unit, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	var v struct {
+		UnitView
+		LegacyStationName string `json:"staion_name"`
+	}
+	if err := json.Unmarshal([]byte(s.String), &v); err != nil {
+		return nil, fmt.Errorf("history decoding error: %w", err)
+	}
+	if v.StationName == "" {
+		v.StationName = v.LegacyStationName
+	}
+	return &Unit{
+		ID:             v.ID,
+		DuID:           v.DuID,
+		StationName:    v.StationName,
+		RegionID:       v.RegionID,
+		FuelSource:     v.FuelSource,
+		TechnologyType: v.TechnologyType,
+		MaxCapacity:    v.MaxCapacity,
+		Latitude:       v.Latitude,
+		Longitude:      v.Longitude,
+		State:          v.State,
+	}, nil
+}
+
+// formatCoordinate formats a coordinate for ETags, empty if unset
+func formatCoordinate(c *float64) string {
+	if c == nil {
+		return ""
+	}
+	return formatFloat(*c)
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// UnitLocation is a row of a unit locations CSV
+type UnitLocation struct {
+	DuID      string
+	Latitude  float64
+	Longitude float64
+	State     string
+}
+
+// Results of importing a unit location
+const (
+	LocationUpdated   = "updated"
+	LocationUnchanged = "unchanged"
+	LocationNotFound  = "not found"
+	LocationInvalid   = "invalid"
+)
+
+// LocationResult is the outcome of importing one unit location, Problem explains invalid rows
+type LocationResult struct {
+	DuID    string
+	Result  string
+	Problem string
+}
+
+// ParseUnitLocationsCSV reads unit locations from CSV with a header naming the duid, latitude,
+// longitude and optionally state columns, in any order and case
+func ParseUnitLocationsCSV(r io.Reader) ([]UnitLocation, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("models.ParseUnitLocationsCSV: header error: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"duid", "latitude", "longitude"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("models.ParseUnitLocationsCSV: missing %s column", required)
+		}
+	}
+	stateColumn, hasState := columns["state"]
+
+	locations := make([]UnitLocation, 0)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return locations, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("models.ParseUnitLocationsCSV: %w", err)
+		}
+
+		location := UnitLocation{DuID: strings.TrimSpace(record[columns["duid"]])}
+		if location.Latitude, err = strconv.ParseFloat(strings.TrimSpace(record[columns["latitude"]]), 64); err != nil {
+			return nil, fmt.Errorf("models.ParseUnitLocationsCSV: line %d: invalid latitude %q", line, record[columns["latitude"]])
+		}
+		if location.Longitude, err = strconv.ParseFloat(strings.TrimSpace(record[columns["longitude"]]), 64); err != nil {
+			return nil, fmt.Errorf("models.ParseUnitLocationsCSV: line %d: invalid longitude %q", line, record[columns["longitude"]])
+		}
+		if hasState {
+			location.State = strings.ToUpper(strings.TrimSpace(record[stateColumn]))
+		}
+		locations = append(locations, location)
+	}
+}
+
+// ImportUnitLocations sets the location of each unit, recording changes in unit_history like any
+// other write, units whose location is already set to the same values are left alone
+func ImportUnitLocations(ctx context.Context, db *sql.DB, locations []UnitLocation, actor string) ([]LocationResult, error) {
+	results := make([]LocationResult, 0, len(locations))
+	for _, location := range locations {
+		result := LocationResult{DuID: location.DuID}
+
+		current, err := ReadUnit(ctx, db, location.DuID)
+		if errors.Is(err, ErrUnitNotFound) {
+			result.Result = LocationNotFound
+			results = append(results, result)
+			continue
+		}
+		if err != nil {
+			return results, fmt.Errorf("models.ImportUnitLocations: %w", err)
+		}
+
+		if current.Latitude != nil && *current.Latitude == location.Latitude &&
+			current.Longitude != nil && *current.Longitude == location.Longitude && current.State == location.State {
+			result.Result = LocationUnchanged
+			results = append(results, result)
+			continue
+		}
+
+		latitude, longitude, state := location.Latitude, location.Longitude, location.State
+		patch := UnitPatch{Latitude: &latitude, Longitude: &longitude, State: &state}
+		_, err = PatchUnit(ctx, db, location.DuID, patch, current.ETag(), actor)
+		var invalid *UnitValidationError
+		switch {
+		case errors.As(err, &invalid):
+			result.Result, result.Problem = LocationInvalid, invalid.Error()
+		case errors.Is(err, ErrUnitNotFound):
+			result.Result = LocationNotFound
+		case err != nil:
+			return results, fmt.Errorf("models.ImportUnitLocations: %w", err)
+		default:
+			result.Result = LocationUpdated
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,407 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"NemWebGoApi/internal/logging"
+	"NemWebGoApi/internal/metrics"
+)
+
+const (
+	// DefaultUnitPageSize is the page size when a cursor is given without a limit
+	DefaultUnitPageSize = 100
+	// MaxUnitPageSize is the largest limit accepted
+	MaxUnitPageSize = 1000
+)
+
+// ErrInvalidUnitQuery is returned for unknown sort or field names, bad limits and bad cursors
+var ErrInvalidUnitQuery = errors.New("invalid unit query")
+
+// unitField is a field of the response schema and the column it is sorted by
+type unitField struct {
+	name    string
+	column  string
+	numeric bool
+}
+
+// unitFields are the fields units can be sorted and selected by, numeric columns are coalesced
+// to 0 and text to ” so NULLs sort and compare like scanUnit reads them
+var unitFields = []unitField{
+	{"id", "rowid", true},
+	{"duid", "COALESCE(duid, '')", false},
+	{"station_name", "COALESCE(station_name, '')", false},
+	{"region_id", "COALESCE(region_id, '')", false},
+	{"fuel_source", "COALESCE(fuel_source, '')", false},
+	{"technology_type", "COALESCE(technology_type, '')", false},
+	{"max_capacity", "COALESCE(max_capacity, 0)", true},
+	{"latitude", "COALESCE(latitude, 0)", true},
+	{"longitude", "COALESCE(longitude, 0)", true},
+	{"state", "COALESCE(state, '')", false},
+}
+
+// UnitSort orders units by a field, descending if Desc
+type UnitSort struct {
+	Field string
+	Desc  bool
+}
+
+// UnitQuery selects a page of units, a Limit of 0 returns every unit after the cursor
+type UnitQuery struct {
+	Filter UnitFilter
+	Sort   []UnitSort
+	Fields []string // empty for every field
+	Limit  int
+	Cursor string
+}
+
+// UnitPage is a page of units with the total matching the filter and the cursor of the next page,
+// NextCursor is empty on the last page
+type UnitPage struct {
+	Units      []Unit
+	Total      int
+	NextCursor string
+}
+
+// UnitView is a unit in version 2 of the response schema, station_name is spelt correctly
+// and every field is present
+type UnitView struct {
+	ID             int64    `json:"id"`
+	DuID           string   `json:"duid"`
+	StationName    string   `json:"station_name"`
+	RegionID       string   `json:"region_id"`
+	FuelSource     string   `json:"fuel_source"`
+	TechnologyType string   `json:"technology_type"`
+	MaxCapacity    int64    `json:"max_capacity"`
+	Latitude       *float64 `json:"latitude"`
+	Longitude      *float64 `json:"longitude"`
+	State          string   `json:"state"`
+}
+
+// unitCursor is the position after the last unit of a page, encoded as base64 JSON
+type unitCursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+// View returns the unit in version 2 of the response schema
+func (u Unit) View() UnitView {
+	return UnitView{
+		ID:             u.ID,
+		DuID:           u.DuID,
+		StationName:    u.StationName,
+		RegionID:       u.RegionID,
+		FuelSource:     u.FuelSource,
+		TechnologyType: u.TechnologyType,
+		MaxCapacity:    u.MaxCapacity,
+		Latitude:       u.Latitude,
+		Longitude:      u.Longitude,
+		State:          u.State,
+	}
+}
+
+// SelectFields returns only the named fields of the unit, using the legacy staion_name key if legacy
+func (u Unit) SelectFields(fields []string, legacy bool) map[string]interface{} {
+	selected := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		key := field
+		if legacy && field == "station_name" {
+			key = "staion_name"
+		}
+		selected[key] = u.fieldValue(field)
+	}
+	return selected
+}
+
+func (u Unit) fieldValue(field string) interface{} {
+	switch field {
+	case "id":
+		return u.ID
+	case "duid":
+		return u.DuID
+	case "station_name":
+		return u.StationName
+	case "region_id":
+		return u.RegionID
+	case "fuel_source":
+		return u.FuelSource
+	case "technology_type":
+		return u.TechnologyType
+	case "max_capacity":
+		return u.MaxCapacity
+	case "latitude":
+		return u.Latitude
+	case "longitude":
+		return u.Longitude
+	case "state":
+		return u.State
+	}
+	return nil
+}
+
+// sortValue returns the value the unit is sorted by for field, a missing location is 0 as
+// in the coalesced sort column
+func (u Unit) sortValue(field string) interface{} {
+	switch field {
+	case "latitude", "longitude":
+		if c, ok := u.fieldValue(field).(*float64); ok && c != nil {
+			return *c
+		}
+		return float64(0)
+	}
+	return u.fieldValue(field)
+}
+
+// ParseUnitQuery reads the unit filters plus sort, fields, limit and cursor from filterMap
+// e.g. sort=max_capacity,-station_name&fields=duid,region_id&limit=50
+func ParseUnitQuery(filterMap map[string][]string) (UnitQuery, error) {
+	query := UnitQuery{Filter: ParseUnitFilterMap(filterMap)}
+	if err := query.Filter.Location.Err(); err != nil {
+		return query, fmt.Errorf("%w: %v", ErrInvalidUnitQuery, err)
+	}
+
+	for _, field := range splitList(filterMap["sort"]) {
+		sort := UnitSort{Field: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")}
+		if _, ok := lookupUnitField(sort.Field); !ok {
+			return query, fmt.Errorf("%w: unknown sort field %s", ErrInvalidUnitQuery, sort.Field)
+		}
+		query.Sort = append(query.Sort, sort)
+	}
+
+	for _, field := range splitList(filterMap["fields"]) {
+		if field == "staion_name" {
+			field = "station_name"
+		}
+		if _, ok := lookupUnitField(field); !ok {
+			return query, fmt.Errorf("%w: unknown field %s", ErrInvalidUnitQuery, field)
+		}
+		if !containsString(query.Fields, field) {
+			query.Fields = append(query.Fields, field)
+		}
+	}
+
+	if val, ok := filterMap["limit"]; ok {
+		limit, err := strconv.Atoi(val[0])
+		if err != nil || limit < 1 || limit > MaxUnitPageSize {
+			return query, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidUnitQuery, MaxUnitPageSize)
+		}
+		query.Limit = limit
+	}
+
+	if val, ok := filterMap["cursor"]; ok {
+		query.Cursor = val[0]
+		if query.Limit == 0 {
+			query.Limit = DefaultUnitPageSize
+		}
+	}
+	return query, nil
+}
+
+// Paginated reports whether a page was asked for rather than every unit
+func (q UnitQuery) Paginated() bool {
+	return q.Limit > 0 || q.Cursor != ""
+}
+
+// ReadUnitPage returns the units matching the query in its sort order, ties broken by id
+func ReadUnitPage(ctx context.Context, db *sql.DB, q UnitQuery) (UnitPage, error) {
+	page := UnitPage{Units: make([]Unit, 0)}
+	sorts := q.sortKeys()
+	where := buildSQLQuery(q.Filter)
+
+	countQuery := "SELECT COUNT(*) FROM units" + where
+	countCtx, done := startQuery(ctx, metrics.StoreSQLite, "units", countQuery)
+	if err := db.QueryRowContext(countCtx, countQuery).Scan(&page.Total); err != nil {
+		done(0, err)
+		return page, fmt.Errorf("models.ReadUnitPage: count error: %w", err)
+	}
+	done(1, nil)
+
+	query := "SELECT " + unitColumns + " FROM units" + where
+	args := make([]interface{}, 0)
+	if q.Cursor != "" {
+		cursor, err := decodeUnitCursor(q.Cursor, sorts)
+		if err != nil {
+			return page, err
+		}
+		keyset, keysetArgs := buildKeysetStatement(sorts, cursor.Values)
+		if where == "" {
+			query += "\nWHERE " + keyset
+		} else {
+			query += "\nAND " + keyset
+		}
+		args = append(args, keysetArgs...)
+	}
+
+	order := make([]string, 0, len(sorts))
+	for _, sort := range sorts {
+		field, _ := lookupUnitField(sort.Field)
+		if sort.Desc {
+			order = append(order, field.column+" DESC")
+		} else {
+			order = append(order, field.column+" ASC")
+		}
+	}
+	query += "\nORDER BY " + strings.Join(order, ", ")
+	if q.Limit > 0 {
+		// One extra row tells us whether there is a next page
+		query += fmt.Sprintf("\nLIMIT %d", q.Limit+1)
+	}
+	logging.FromContext(ctx).Traceln(query)
+
+	ctx, done = startQuery(ctx, metrics.StoreSQLite, "units", query)
+	results, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		done(0, err)
+		return page, fmt.Errorf("models.ReadUnitPage: query error: %w", err)
+	}
+	defer results.Close()
+
+	for results.Next() {
+		unit, err := scanUnit(results)
+		if err != nil {
+			done(0, err)
+			return page, fmt.Errorf("models.ReadUnitPage: scan error: %w", err)
+		}
+		page.Units = append(page.Units, *unit)
+	}
+	if err := results.Err(); err != nil {
+		done(0, err)
+		return page, fmt.Errorf("models.ReadUnitPage: query parsing error: %w", err)
+	}
+	done(len(page.Units), nil)
+
+	if q.Limit > 0 && len(page.Units) > q.Limit {
+		page.Units = page.Units[:q.Limit]
+		page.NextCursor = encodeUnitCursor(sorts, page.Units[len(page.Units)-1])
+	}
+	return page, nil
+}
+
+// sortKeys returns the query's sort with id appended as a tie-breaker so the order is total
+func (q UnitQuery) sortKeys() []UnitSort {
+	sorts := append([]UnitSort{}, q.Sort...)
+	for _, sort := range sorts {
+		if sort.Field == "id" {
+			return sorts
+		}
+	}
+	return append(sorts, UnitSort{Field: "id"})
+}
+
+// buildKeysetStatement returns the condition selecting rows after values in the sort order,
+// (a > ?) OR (a = ? AND b > ?) ... with < for descending fields
+func buildKeysetStatement(sorts []UnitSort, values []interface{}) (string, []interface{}) {
+	clauses := make([]string, 0, len(sorts))
+	args := make([]interface{}, 0)
+	for i, sort := range sorts {
+		terms := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			field, _ := lookupUnitField(sorts[j].Field)
+			terms = append(terms, field.column+" = ?")
+			args = append(args, values[j])
+		}
+		field, _ := lookupUnitField(sort.Field)
+		op := ">"
+		if sort.Desc {
+			op = "<"
+		}
+		terms = append(terms, fmt.Sprintf("%s %s ?", field.column, op))
+		args = append(args, values[i])
+		clauses = append(clauses, "("+strings.Join(terms, " AND ")+")")
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")", args
+}
+
+func encodeUnitCursor(sorts []UnitSort, last Unit) string {
+	cursor := unitCursor{Sort: sortString(sorts)}
+	for _, sort := range sorts {
+		cursor.Values = append(cursor.Values, last.sortValue(sort.Field))
+	}
+	body, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(body)
+}
+
+// decodeUnitCursor reads a cursor, which is only valid with the sort it was made with
+func decodeUnitCursor(encoded string, sorts []UnitSort) (unitCursor, error) {
+	var cursor unitCursor
+	body, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, fmt.Errorf("%w: malformed cursor", ErrInvalidUnitQuery)
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(body)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&cursor); err != nil {
+		return cursor, fmt.Errorf("%w: malformed cursor", ErrInvalidUnitQuery)
+	}
+	if cursor.Sort != sortString(sorts) {
+		return cursor, fmt.Errorf("%w: cursor was made with a different sort", ErrInvalidUnitQuery)
+	}
+	if len(cursor.Values) != len(sorts) {
+		return cursor, fmt.Errorf("%w: malformed cursor", ErrInvalidUnitQuery)
+	}
+
+	for i, sort := range sorts {
+		field, _ := lookupUnitField(sort.Field)
+		switch v := cursor.Values[i].(type) {
+		case json.Number:
+			if !field.numeric {
+				return cursor, fmt.Errorf("%w: malformed cursor", ErrInvalidUnitQuery)
+			}
+			// Coordinates are fractional, ids and capacities are kept as integers
+			if n, err := v.Int64(); err == nil {
+				cursor.Values[i] = n
+			} else if f, err := v.Float64(); err == nil {
+				cursor.Values[i] = f
+			} else {
+				return cursor, fmt.Errorf("%w: malformed cursor", ErrInvalidUnitQuery)
+			}
+		case string:
+			if field.numeric {
+				return cursor, fmt.Errorf("%w: malformed cursor", ErrInvalidUnitQuery)
+			}
+		default:
+			return cursor, fmt.Errorf("%w: malformed cursor", ErrInvalidUnitQuery)
+		}
+	}
+	return cursor, nil
+}
+
+func sortString(sorts []UnitSort) string {
+	fields := make([]string, 0, len(sorts))
+	for _, sort := range sorts {
+		if sort.Desc {
+			fields = append(fields, "-"+sort.Field)
+		} else {
+			fields = append(fields, sort.Field)
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+func lookupUnitField(name string) (unitField, bool) {
+	for _, field := range unitFields {
+		if field.name == name {
+			return field, true
+		}
+	}
+	return unitField{}, false
+}
+
+// splitList splits comma separated and repeated query parameter values, dropping empty entries
+func splitList(values []string) []string {
+	list := make([]string, 0)
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"NemWebGoApi/internal/sqlite"
+)
+
+func coordinate(c float64) *float64 {
+	return &c
+}
+
+func TestUnitCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		sort  []UnitSort
+		unit  Unit
+		value interface{} // decoded value of the first sort key
+	}{
+		{"integer", []UnitSort{{Field: "max_capacity"}}, Unit{ID: 7, MaxCapacity: 660}, int64(660)},
+		{"text", []UnitSort{{Field: "station_name", Desc: true}}, Unit{ID: 7, StationName: "Bayswater"}, "Bayswater"},
+		{"fractional latitude", []UnitSort{{Field: "latitude"}}, Unit{ID: 7, Latitude: coordinate(-32.39), Longitude: coordinate(150.95)}, -32.39},
+		{"fractional longitude", []UnitSort{{Field: "longitude", Desc: true}}, Unit{ID: 7, Latitude: coordinate(-32.39), Longitude: coordinate(150.95)}, 150.95},
+		{"whole latitude", []UnitSort{{Field: "latitude"}}, Unit{ID: 7, Latitude: coordinate(-32), Longitude: coordinate(150)}, int64(-32)},
+		{"missing latitude sorts as 0", []UnitSort{{Field: "latitude"}}, Unit{ID: 7}, int64(0)},
+		{"missing longitude sorts as 0", []UnitSort{{Field: "longitude"}}, Unit{ID: 7}, int64(0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorts := UnitQuery{Sort: tt.sort}.sortKeys()
+			cursor, err := decodeUnitCursor(encodeUnitCursor(sorts, tt.unit), sorts)
+			if err != nil {
+				t.Fatalf("decodeUnitCursor: %v", err)
+			}
+			if len(cursor.Values) != 2 {
+				t.Fatalf("got %d values, want the sort key and id", len(cursor.Values))
+			}
+			if cursor.Values[0] != tt.value {
+				t.Errorf("value = %#v, want %#v", cursor.Values[0], tt.value)
+			}
+			if cursor.Values[1] != int64(tt.unit.ID) {
+				t.Errorf("id = %#v, want %#v", cursor.Values[1], int64(tt.unit.ID))
+			}
+		})
+	}
+}
+
+func TestUnitCursorRejectsWrongTypes(t *testing.T) {
+	numeric := []UnitSort{{Field: "latitude"}, {Field: "id"}}
+	text := []UnitSort{{Field: "duid"}, {Field: "id"}}
+
+	tests := []struct {
+		name   string
+		sorts  []UnitSort
+		cursor string
+	}{
+		{"text for a coordinate", numeric, encodeUnitCursor(text, Unit{ID: 1, DuID: "A"})},
+		{"null for a coordinate", numeric, "eyJzIjoibGF0aXR1ZGUsaWQiLCJ2IjpbbnVsbCwxXX0"},
+		{"number for text", text, encodeUnitCursor(numeric, Unit{ID: 1})},
+		{"not base64", numeric, "!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeUnitCursor(tt.cursor, tt.sorts); err == nil {
+				t.Fatal("decodeUnitCursor accepted the cursor")
+			}
+		})
+	}
+}
+
+// TestReadUnitPageByLocation pages through units sorted by a coordinate, some without a
+// location, and checks every unit is returned once in order
+func TestReadUnitPageByLocation(t *testing.T) {
+	db, err := sqlite.New(filepath.Join(t.TempDir(), "test.sqlite"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	units := []Unit{
+		{DuID: "NOLOC1"},
+		{DuID: "SOUTH1", Latitude: coordinate(-37.81), Longitude: coordinate(144.96)},
+		{DuID: "NORTH1", Latitude: coordinate(-16.92), Longitude: coordinate(145.77)},
+		{DuID: "NOLOC2"},
+		{DuID: "MIDDLE1", Latitude: coordinate(-32.39), Longitude: coordinate(150.95)},
+		{DuID: "MIDDLE2", Latitude: coordinate(-32.39), Longitude: coordinate(151.2)},
+	}
+	for _, unit := range units {
+		unit.StationName, unit.RegionID, unit.FuelSource, unit.TechnologyType = unit.DuID, "NSW1", "Solar", "PV"
+		if _, err := CreateUnit(ctx, db, unit, "test"); err != nil {
+			t.Fatalf("CreateUnit %s: %v", unit.DuID, err)
+		}
+	}
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"latitude", []string{"SOUTH1", "MIDDLE1", "MIDDLE2", "NORTH1", "NOLOC1", "NOLOC2"}},
+		{"-latitude", []string{"NOLOC1", "NOLOC2", "NORTH1", "MIDDLE1", "MIDDLE2", "SOUTH1"}},
+		{"longitude", []string{"NOLOC1", "NOLOC2", "SOUTH1", "NORTH1", "MIDDLE1", "MIDDLE2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			query, err := ParseUnitQuery(map[string][]string{"sort": {tt.sort}, "limit": {"2"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, 0, len(units))
+			for pages := 0; ; pages++ {
+				if pages > len(units) {
+					t.Fatalf("paging did not end, read %v", got)
+				}
+				page, err := ReadUnitPage(ctx, db, query)
+				if err != nil {
+					t.Fatalf("ReadUnitPage: %v", err)
+				}
+				for _, unit := range page.Units {
+					got = append(got, unit.DuID)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("read %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("read %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
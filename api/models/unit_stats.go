@@ -0,0 +1,147 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"NemWebGoApi/internal/metrics"
+
+	"github.com/influxdata/influxdb-client-go/v2/api"
+)
+
+// UnitStatsLookback is how far back the latest generation point of a unit is searched for
+const UnitStatsLookback = "-30d"
+
+// UnitStats are derived from a unit's generation data
+type UnitStats struct {
+	LatestOutput   *float64   `json:"latest_output"`   // MW at LastSeen
+	LastSeen       *time.Time `json:"last_seen"`       // time of the latest generation point within the lookback
+	Energy24h      float64    `json:"energy_24h"`      // MWh generated over the last 24 hours
+	CapacityFactor *float64   `json:"capacity_factor"` // mean output over the range / max capacity, null without capacity or data
+}
+
+// UnitDetail is a unit with its generation stats
+type UnitDetail struct {
+	Unit
+	Stats UnitStats `json:"stats"`
+}
+
+// StationDetail is a station's units with their stats and the stats of the station as a whole
+type StationDetail struct {
+	StationName string       `json:"station_name"`
+	RegionID    string       `json:"region_id"`
+	MaxCapacity int64        `json:"max_capacity"`
+	Units       []UnitDetail `json:"units"`
+	Stats       UnitStats    `json:"stats"`
+}
+
+// ReadUnitStats returns stats for each unit keyed by DUID, the capacity factor is taken over rng
+// Units without generation data have empty stats
+func ReadUnitStats(ctx context.Context, db api.QueryAPI, bucket string, units []Unit, rng RangeFilter) (map[string]UnitStats, error) {
+	stats := make(map[string]UnitStats, len(units))
+	if len(units) == 0 {
+		return stats, nil
+	}
+
+	duids := make([]string, 0, len(units))
+	for _, u := range units {
+		duids = append(duids, u.DuID)
+		stats[u.DuID] = UnitStats{}
+	}
+	unitFilter, _ := buildStringFilterFluxStatement(StringFilter{eq: duids}, "unit")
+	generation := func(rangeStmt string) string {
+		return strings.Join([]string{
+			fmt.Sprintf("from(bucket: \"%s\")", bucket),
+			rangeStmt,
+			"\t|> filter(fn: (r) => r._measurement == \"generation\")",
+			unitFilter,
+		}, "\n")
+	}
+	rangeStmt, _ := buildRangeFilterFluxStatement(rng)
+
+	fluxQuery := generation(fmt.Sprintf("\t|> range(start: %s)", UnitStatsLookback)) + "\n\t|> last()\n\t|> yield(name: \"last\")\n"
+	fluxQuery += generation("\t|> range(start: -24h)") + "\n\t|> sum()\n\t|> yield(name: \"energy\")\n"
+	fluxQuery += generation(rangeStmt) + "\n\t|> mean()\n\t|> yield(name: \"mean\")\n"
+
+	ctx, done := startQuery(ctx, metrics.StoreInflux, "generation", fluxQuery)
+	result, err := db.Query(ctx, fluxQuery)
+	if err != nil {
+		done(0, err)
+		return nil, fmt.Errorf("models.ReadUnitStats: query error: %w", err)
+	}
+	defer result.Close()
+
+	capacity := make(map[string]int64, len(units))
+	for _, u := range units {
+		capacity[u.DuID] = u.MaxCapacity
+	}
+
+	rows := 0
+	for result.Next() {
+		rows++
+		record := result.Record()
+		duid := fmt.Sprintf("%v", record.ValueByKey("unit"))
+		value, _ := getFloatReflectOnly(record.Value())
+		s := stats[duid]
+
+		switch record.Result() {
+		case "last":
+			t := record.Time()
+			s.LastSeen = &t
+			s.LatestOutput = &value
+		case "energy":
+			s.Energy24h = value * GenerationInterval.Hours()
+		case "mean":
+			if capacity[duid] > 0 {
+				cf := value / float64(capacity[duid])
+				s.CapacityFactor = &cf
+			}
+		}
+		stats[duid] = s
+	}
+	if result.Err() != nil {
+		done(0, result.Err())
+		return nil, fmt.Errorf("models.ReadUnitStats: query parsing error: %w", result.Err())
+	}
+
+	done(rows, nil)
+	return stats, nil
+}
+
+// NewStationDetail combines the stats of a station's units, the capacity factor is
+// weighted by capacity and the latest output sums each unit's latest point
+func NewStationDetail(name string, units []Unit, stats map[string]UnitStats) StationDetail {
+	station := StationDetail{StationName: name, Units: make([]UnitDetail, 0, len(units))}
+
+	var meanOutput float64
+	var reporting int64
+	for _, u := range units {
+		s := stats[u.DuID]
+		station.Units = append(station.Units, UnitDetail{Unit: u, Stats: s})
+		station.MaxCapacity += u.MaxCapacity
+		station.RegionID = u.RegionID
+		station.Stats.Energy24h += s.Energy24h
+
+		if s.LatestOutput != nil {
+			total := *s.LatestOutput
+			if station.Stats.LatestOutput != nil {
+				total += *station.Stats.LatestOutput
+			}
+			station.Stats.LatestOutput = &total
+		}
+		if s.LastSeen != nil && (station.Stats.LastSeen == nil || s.LastSeen.After(*station.Stats.LastSeen)) {
+			station.Stats.LastSeen = s.LastSeen
+		}
+		if s.CapacityFactor != nil {
+			meanOutput += *s.CapacityFactor * float64(u.MaxCapacity)
+			reporting += u.MaxCapacity
+		}
+	}
+	if reporting > 0 {
+		cf := meanOutput / float64(reporting)
+		station.Stats.CapacityFactor = &cf
+	}
+	return station
+}
@@ -1,20 +1,41 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	log "github.com/sirupsen/logrus"
+	"time"
+
+	"NemWebGoApi/internal/cache"
+	"NemWebGoApi/internal/logging"
+	"NemWebGoApi/internal/metrics"
 )
 
+// unitCache holds unit query results keyed by SQL query, units change rarely but are read on every
+// generation request. It is off until a TTL is set, as units written by the scraper or another
+// process are not seen until their cached results expire
+var unitCache = cache.New("units", 0)
+
+// SetUnitCacheTTL sets how long unit query results are cached, zero disables caching
+func SetUnitCacheTTL(ttl time.Duration) {
+	unitCache.SetTTL(ttl)
+}
+
+// unitColumns are the columns scanned by scanUnit, id is the SQLite rowid
+const unitColumns = "rowid, duid, station_name, region_id, fuel_source, technology_type, max_capacity, latitude, longitude, state"
+
 // Unit is the structure of the unit table in the sqlite database
 type Unit struct {
-	ID             int    `json:"id,omitempty"`
-	DuID           string `json:"duid,omitempty"`
-	StationName    string `json:"staion_name,omitempty"`
-	RegionID       string `json:"region_id,omitempty"`
-	FuelSource     string `json:"fuel_source,omitempty"`
-	TechnologyType string `json:"technology_type,omitempty"`
-	MaxCapacity    int64  `json:"max_capacity,omitempty"`
+	ID             int64    `json:"id,omitempty"`
+	DuID           string   `json:"duid,omitempty"`
+	StationName    string   `json:"staion_name,omitempty"`
+	RegionID       string   `json:"region_id,omitempty"`
+	FuelSource     string   `json:"fuel_source,omitempty"`
+	TechnologyType string   `json:"technology_type,omitempty"`
+	MaxCapacity    int64    `json:"max_capacity,omitempty"`
+	Latitude       *float64 `json:"latitude,omitempty"`
+	Longitude      *float64 `json:"longitude,omitempty"`
+	State          string   `json:"state,omitempty"`
 }
 
 type UnitFilter struct {
@@ -24,86 +45,125 @@ type UnitFilter struct {
 	FuelSource     StringFilter `col:"fuel_source" param:"fuel_source"`
 	TechnologyType StringFilter `col:"technology_type" param:"technology_type"`
 	MaxCapacity    IntFilter    `col:"max_capacity" param:"max_capacity"`
+	State          StringFilter `col:"state" param:"state"`
+	Location       GeoFilter    `col:"location"` // col is unused for location but required for parsing
 }
 
 // ReadAll returns all units in the database
-func (u *Unit) ReadAll(db *sql.DB, filter UnitFilter) (*[]Unit, error) {
-	query := "SELECT duid, station_name, region_id, fuel_source, technology_type, max_capacity FROM units"
+func (u *Unit) ReadAll(ctx context.Context, db *sql.DB, filter UnitFilter) (*[]Unit, error) {
+	query := "SELECT " + unitColumns + " FROM units"
 	query += buildSQLQuery(filter)
-    log.Traceln(query)
-	results, err := db.Query(query)
+	logging.FromContext(ctx).Traceln(query)
+
+	if cached, ok := unitCache.Get(query); ok {
+		units := append([]Unit{}, cached.([]Unit)...)
+		return &units, nil
+	}
+
+	ctx, done := startQuery(ctx, metrics.StoreSQLite, "units", query)
+	results, err := db.QueryContext(ctx, query)
 	if err != nil {
-		return &[]Unit{}, fmt.Errorf("models.unit.readall: query error: %v", err)
+		done(0, err)
+		return &[]Unit{}, fmt.Errorf("models.unit.readall: query error: %w", err)
 	}
+	defer results.Close()
 
 	units := make([]Unit, 0)
 	for results.Next() {
-		var unit Unit
-		results.Scan(
-			&unit.DuID,
-			&unit.StationName,
-			&unit.RegionID,
-			&unit.FuelSource,
-			&unit.TechnologyType,
-			&unit.MaxCapacity,
-		)
-		units = append(units, unit)
+		unit, err := scanUnit(results)
+		if err != nil {
+			done(0, err)
+			return &[]Unit{}, fmt.Errorf("models.unit.readall: scan error: %w", err)
+		}
+		units = append(units, *unit)
 	}
+	if err := results.Err(); err != nil {
+		done(0, err)
+		return &[]Unit{}, fmt.Errorf("models.unit.readall: query parsing error: %w", err)
+	}
+	done(len(units), nil)
+
+	unitCache.Set(query, append([]Unit{}, units...))
 	return &units, nil
 }
 
-func GetUniqueRegions(db *sql.DB) ([]string, error) {
-	query := "SELECT DISTINCT region_id FROM units"
-	results, err := db.Query(query)
+// ReadStationUnits returns the units of the station with the exact name, ordered by DUID
+func ReadStationUnits(ctx context.Context, db *sql.DB, name string) ([]Unit, error) {
+	query := "SELECT " + unitColumns + " FROM units WHERE station_name = ? ORDER BY duid"
+	ctx, done := startQuery(ctx, metrics.StoreSQLite, "units", query)
+	results, err := db.QueryContext(ctx, query, name)
 	if err != nil {
-		return []string{}, fmt.Errorf("models.getUniqueRegions: query error: %v", err)
+		done(0, err)
+		return []Unit{}, fmt.Errorf("models.ReadStationUnits: query error: %w", err)
 	}
+	defer results.Close()
 
-	regions := make([]string, 0)
+	units := make([]Unit, 0)
 	for results.Next() {
-		var region string
-		results.Scan(
-			&region,
-		)
-		regions = append(regions, region)
+		unit, err := scanUnit(results)
+		if err != nil {
+			done(0, err)
+			return []Unit{}, fmt.Errorf("models.ReadStationUnits: scan error: %w", err)
+		}
+		units = append(units, *unit)
+	}
+	if err := results.Err(); err != nil {
+		done(0, err)
+		return []Unit{}, fmt.Errorf("models.ReadStationUnits: query parsing error: %w", err)
 	}
-	return regions, nil
+	done(len(units), nil)
+	return units, nil
 }
 
-func GetUniqueFuels(db *sql.DB) ([]string, error) {
-	query := "SELECT DISTINCT fuel_source FROM units"
-	results, err := db.Query(query)
-	if err != nil {
-		return []string{}, fmt.Errorf("models.getUniqueFuels: query error: %v", err)
-	}
+func GetUniqueRegions(ctx context.Context, db *sql.DB) ([]string, error) {
+	return readDistinct(ctx, db, "region_id", "models.getUniqueRegions")
+}
 
-	fuels := make([]string, 0)
-	for results.Next() {
-		var fuel string
-		results.Scan(
-			&fuel,
-		)
-		fuels = append(fuels, fuel)
-	}
-	return fuels, nil
+func GetUniqueFuels(ctx context.Context, db *sql.DB) ([]string, error) {
+	return readDistinct(ctx, db, "fuel_source", "models.getUniqueFuels")
+}
+
+func GetUniqueStations(ctx context.Context, db *sql.DB) ([]string, error) {
+	return readDistinct(ctx, db, "station_name", "models.getUniqueStations")
+}
+
+func GetUniqueTechnologies(ctx context.Context, db *sql.DB) ([]string, error) {
+	return readDistinct(ctx, db, "technology_type", "models.getUniqueTechnologies")
 }
 
-func GetUniqueTechnologies(db *sql.DB) ([]string, error) {
-	query := "SELECT DISTINCT technology_type FROM units"
-	results, err := db.Query(query)
+// readDistinct returns the distinct values of a column in the units table,
+// caller is used to prefix errors
+func readDistinct(ctx context.Context, db *sql.DB, column string, caller string) ([]string, error) {
+	query := fmt.Sprintf("SELECT DISTINCT %s FROM units", column)
+
+	if cached, ok := unitCache.Get(query); ok {
+		return append([]string{}, cached.([]string)...), nil
+	}
+
+	ctx, done := startQuery(ctx, metrics.StoreSQLite, "units", query)
+	results, err := db.QueryContext(ctx, query)
 	if err != nil {
-		return []string{}, fmt.Errorf("models.getUniqueTechnologies: query error: %v", err)
+		done(0, err)
+		return []string{}, fmt.Errorf("%s: query error: %w", caller, err)
 	}
+	defer results.Close()
 
-	technologies := make([]string, 0)
+	values := make([]string, 0)
 	for results.Next() {
-		var technology string
+		var value string
 		results.Scan(
-			&technology,
+			&value,
 		)
-		technologies = append(technologies, technology)
+		values = append(values, value)
 	}
-	return technologies, nil
+	if err := results.Err(); err != nil {
+		done(0, err)
+		return []string{}, fmt.Errorf("%s: query parsing error: %w", caller, err)
+	}
+	done(len(values), nil)
+
+	unitCache.Set(query, append([]string{}, values...))
+	return values, nil
 }
 
 // Could also maybe use reflect package to clean this
@@ -117,6 +177,8 @@ func ParseUnitFilterMap(filterMap map[string][]string) UnitFilter {
 	filter.TechnologyType.fromFilterMap(filterMap, "technology_type")
 	filter.MaxCapacity.fromFilterMap(filterMap, "max_capacity")
 	filter.Duid.fromFilterMap(filterMap, "unit")
+	filter.State.fromFilterMap(filterMap, "state")
+	filter.Location.fromFilterMap(filterMap)
 
 	return filter
 }
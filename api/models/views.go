@@ -0,0 +1,93 @@
+package models
+
+import "time"
+
+// Views are the version 2 response shapes of models whose version 1 shapes are frozen,
+// they fix field names such as staion_name and say what a series holds
+
+// UnitDetailView is a unit with its generation stats in version 2 of the response schema
+type UnitDetailView struct {
+	UnitView
+	Stats UnitStats `json:"stats"`
+}
+
+// StationDetailView is a station detail in version 2 of the response schema
+type StationDetailView struct {
+	StationName string           `json:"station_name"`
+	RegionID    string           `json:"region_id"`
+	MaxCapacity int64            `json:"max_capacity"`
+	Units       []UnitDetailView `json:"units"`
+	Stats       UnitStats        `json:"stats"`
+}
+
+// UnitChangeView is a recorded unit change in version 2 of the response schema
+type UnitChangeView struct {
+	ID        int64     `json:"id"`
+	DuID      string    `json:"duid"`
+	Action    string    `json:"action"`
+	ChangedBy string    `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+	Before    *UnitView `json:"before"`
+	After     *UnitView `json:"after"`
+}
+
+// GroupSeries is the generation of a group of units summed per interval, version 1 returns
+// these as GenerationDataPoint with the group name in unit
+type GroupSeries struct {
+	Group string      `json:"group"`
+	Units []string    `json:"units"`
+	Data  []DataPoint `json:"data"`
+}
+
+// View returns the unit detail in version 2 of the response schema
+func (d UnitDetail) View() UnitDetailView {
+	return UnitDetailView{UnitView: d.Unit.View(), Stats: d.Stats}
+}
+
+// View returns the station detail in version 2 of the response schema
+func (d StationDetail) View() StationDetailView {
+	view := StationDetailView{
+		StationName: d.StationName,
+		RegionID:    d.RegionID,
+		MaxCapacity: d.MaxCapacity,
+		Units:       make([]UnitDetailView, 0, len(d.Units)),
+		Stats:       d.Stats,
+	}
+	for _, unit := range d.Units {
+		view.Units = append(view.Units, unit.View())
+	}
+	return view
+}
+
+// View returns the change in version 2 of the response schema
+func (c UnitChange) View() UnitChangeView {
+	view := UnitChangeView{
+		ID:        c.ID,
+		DuID:      c.DuID,
+		Action:    c.Action,
+		ChangedBy: c.ChangedBy,
+		ChangedAt: c.ChangedAt,
+	}
+	if c.Before != nil {
+		before := c.Before.View()
+		view.Before = &before
+	}
+	if c.After != nil {
+		after := c.After.View()
+		view.After = &after
+	}
+	return view
+}
+
+// NewGroupSeries pairs grouped generation with the DUIDs of each group
+func NewGroupSeries(data []GenerationDataPoint, groups map[string][]Unit) []GroupSeries {
+	series := make([]GroupSeries, 0, len(data))
+	for _, d := range data {
+		duids := make([]string, 0, len(groups[d.Unit]))
+		for _, unit := range groups[d.Unit] {
+			duids = append(duids, unit.DuID)
+		}
+		series = append(series, GroupSeries{Group: d.Unit, Units: duids, Data: d.Data})
+	}
+	return series
+}
@@ -1,23 +1,47 @@
 package api
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"NemWebGoApi/api/controllers"
 	"NemWebGoApi/internal/config"
+	"NemWebGoApi/internal/tracing"
 
 	log "github.com/sirupsen/logrus"
 )
 
 var server = controllers.Server{}
 var cfg *config.Config
+var shutdownTracing func(context.Context) error
 
-func Init(testing bool) controllers.Server {
+// Init loads the configuration from args and the environment, then sets up tracing and the server
+func Init(testing bool, args []string) controllers.Server {
 	// if err := godotenv.Load(); err != nil {
 	// 	log.Warnln("Error reading .env file: ", err)
 	// }
 
-	cfg = config.New()
+	var err error
+	cfg, err = config.New(args)
+	if err != nil {
+		log.Fatalln(err)
+	}
 
-	err := server.Init(
+	shutdownTracing, err = tracing.Init(context.Background(), tracing.Options{
+		Exporter:     cfg.TracingExporter(),
+		ServiceName:  cfg.TracingServiceName(),
+		SampleRatio:  cfg.TracingSampleRatio(),
+		OTLPEndpoint: cfg.TracingOTLPEndpoint(),
+		OTLPInsecure: cfg.TracingOTLPInsecure(),
+		QueryText:    cfg.TracingQueryText(),
+	})
+	if err != nil {
+		log.Fatalf("server.Initialize: problem initing tracing: %v", err)
+	}
+
+	err = server.Init(
 		cfg,
 	)
 
@@ -27,7 +51,53 @@ func Init(testing bool) controllers.Server {
 	return server
 }
 
+// Run serves until SIGINT or SIGTERM is received, then drains in-flight requests
+// and closes the database connections before returning
 func Run(testing bool) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go watchConfig(ctx)
+
 	log.Infoln("Server starting")
-	server.Run(":" + cfg.Port())
+	runErr := server.Run(ctx, ":"+cfg.Port())
+
+	if err := server.Close(); err != nil {
+		log.Errorln(err)
+	}
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout())
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.Errorln("Error flushing traces:", err)
+	}
+	if runErr != nil {
+		log.Fatalln(runErr)
+	}
+	log.Infoln("Server stopped")
+}
+
+// watchConfig reloads the configuration on SIGHUP or when the config file changes, until ctx is cancelled
+func watchConfig(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	changed := cfg.Watch(ctx, cfg.WatchInterval())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Infoln("SIGHUP received, reloading config")
+		case _, ok := <-changed:
+			if !ok {
+				return
+			}
+			log.Infoln("Config file changed, reloading config")
+		}
+		if err := server.ReloadConfig(); err != nil {
+			log.Errorln(err)
+		}
+	}
 }
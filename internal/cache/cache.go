@@ -0,0 +1,104 @@
+// Package cache provides a small in-memory TTL cache for query results
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"NemWebGoApi/internal/metrics"
+)
+
+// MaxEntries bounds the size of a cache, keys can include client supplied values so the
+// entry expiring soonest is evicted to make room once expired entries are removed
+const MaxEntries = 1024
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// Cache is a concurrency safe key value store whose entries expire after a TTL,
+// a TTL of zero disables caching
+type Cache struct {
+	name  string
+	mu    sync.RWMutex
+	ttl   time.Duration
+	items map[string]entry
+}
+
+// New returns an empty cache, name is used to label its metrics
+func New(name string, ttl time.Duration) *Cache {
+	return &Cache{
+		name:  name,
+		ttl:   ttl,
+		items: make(map[string]entry),
+	}
+}
+
+// Get returns the value for key if present and not expired
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	if c.ttl <= 0 {
+		c.mu.RUnlock()
+		return nil, false
+	}
+	e, ok := c.items[key]
+	c.mu.RUnlock()
+
+	hit := ok && time.Now().Before(e.expires)
+	metrics.ObserveCache(c.name, hit)
+	if !hit {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Set stores value under key until the TTL elapses, evicting entries if the cache is full
+func (c *Cache) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+	if _, ok := c.items[key]; !ok && len(c.items) >= MaxEntries {
+		for k, e := range c.items {
+			if now.After(e.expires) {
+				delete(c.items, k)
+			}
+		}
+	}
+	if _, ok := c.items[key]; !ok && len(c.items) >= MaxEntries {
+		oldest := ""
+		for k, e := range c.items {
+			if oldest == "" || e.expires.Before(c.items[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(c.items, oldest)
+	}
+	c.items[key] = entry{value: value, expires: now.Add(c.ttl)}
+}
+
+// Len returns the number of entries held, including expired entries not yet removed
+func (c *Cache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.items)
+}
+
+// SetTTL changes the TTL for new entries and drops any existing entries
+func (c *Cache) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+	c.items = make(map[string]entry)
+}
+
+// Purge drops every entry, used after writes to the underlying store
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = make(map[string]entry)
+}
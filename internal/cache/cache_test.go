@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCacheDisabledByZeroTTL(t *testing.T) {
+	c := New("test", 0)
+	c.Set("key", 1)
+	if _, ok := c.Get("key"); ok {
+		t.Fatal("cache with a zero TTL returned a value")
+	}
+	if c.Len() != 0 {
+		t.Fatalf("cache with a zero TTL holds %d entries", c.Len())
+	}
+}
+
+func TestCacheBoundedByMaxEntries(t *testing.T) {
+	c := New("test", time.Hour)
+	for i := 0; i < 2*MaxEntries; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	if c.Len() != MaxEntries {
+		t.Fatalf("cache holds %d entries, want %d", c.Len(), MaxEntries)
+	}
+
+	last := strconv.Itoa(2*MaxEntries - 1)
+	if v, ok := c.Get(last); !ok || v != 2*MaxEntries-1 {
+		t.Errorf("latest entry = %v, %v, want it kept", v, ok)
+	}
+
+	// Replacing an entry of a full cache evicts nothing
+	c.Set(last, -1)
+	if c.Len() != MaxEntries {
+		t.Errorf("cache holds %d entries after replacing one, want %d", c.Len(), MaxEntries)
+	}
+}
+
+func TestCacheEvictsExpiredFirst(t *testing.T) {
+	c := New("test", time.Hour)
+	for i := 0; i < MaxEntries; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	c.mu.Lock()
+	c.items["expired"] = entry{value: 0, expires: time.Now().Add(-time.Second)}
+	delete(c.items, "0")
+	c.mu.Unlock()
+
+	c.Set("new", 1)
+	if _, ok := c.items["expired"]; ok {
+		t.Error("expired entry kept when the cache was full")
+	}
+	if _, ok := c.Get("1"); !ok {
+		t.Error("live entry evicted while an expired one could be removed")
+	}
+}
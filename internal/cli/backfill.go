@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"NemWebGoApi/internal/ingest"
+)
+
+// backfillCommand handles "backfill [flags] <path>...", loading MMSDM monthly archives into InfluxDB,
+// resuming from the checkpoints of earlier runs
+func backfillCommand(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	format := formatFlag(fs)
+	workers := fs.Int("workers", ingest.DefaultBackfillWorkers, "archives backfilled at once")
+	batchSize := fs.Int("batch-size", ingest.DefaultBatchSize, "points written to InfluxDB per request")
+	force := fs.Bool("force", false, "backfill archives already checkpointed as done")
+	progress := fs.Duration("progress", 30*time.Second, "how often progress is logged, 0 for never")
+	conf, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: backfill [--workers n] [--batch-size n] [--force] [--progress interval] [flags] <file|dir>...")
+		return errUsage
+	}
+
+	db, err := openStores(conf, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Interrupting stops at the next batch, archives in progress are backfilled again on the next run
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	backfill := ingest.Backfill{
+		Store:     ingest.NewInfluxStore(db.InfluxDB, conf.InfluxOrg(), conf.InfluxBucket()),
+		DB:        db.SQLDb,
+		Workers:   *workers,
+		BatchSize: *batchSize,
+		Force:     *force,
+		Progress:  *progress,
+	}
+	report, err := backfill.Run(ctx, fs.Args()...)
+
+	out := table{header: []string{"path", "error"}}
+	for _, failed := range report.Errors {
+		out.add(failed.Path, failed.Error)
+	}
+	if len(report.Errors) > 0 {
+		if writeErr := out.write(w, *format); writeErr != nil && err == nil {
+			err = writeErr
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d archives: %d done, %d failed, %d already done; %d points written, %d duplicates, %d invalid records in %s (%s points/s)\n",
+		report.Files, report.Done, report.Failed, report.Skipped, report.Points, report.Duplicates, report.Invalid,
+		report.Elapsed.Round(time.Second), strconv.FormatFloat(report.PointsPerSecond(), 'f', 0, 64))
+	if err == nil && report.Failed > 0 {
+		err = fmt.Errorf("%d archives failed, run backfill again to retry them", report.Failed)
+	}
+	return err
+}
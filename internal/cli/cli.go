@@ -0,0 +1,172 @@
+// Package cli implements the command line interface, serving the API
+// or querying the same model layer directly for operators
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"NemWebGoApi/api"
+	"NemWebGoApi/internal/config"
+	"NemWebGoApi/internal/influxdb"
+	"NemWebGoApi/internal/sqlite"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+)
+
+const usage = `Usage: NemWebGoApi <command> [flags] [filters]
+
+Commands:
+  serve                                 run the API (default when no command is given)
+  units list                            list generating units
+  units import-locations <file.csv>     set unit latitude, longitude and state from CSV
+  units import-registration <file>      diff units against AEMO's registration list, --apply to write
+  data demand|rooftop|generation        query time series data
+  quality [filters]                     report missing intervals, stale and unknown units and suspicious values
+  ingest <file|dir>...                  load NEMWEB MMS CSV files or zip archives into InfluxDB
+  backfill <file|dir>...                resumably load MMSDM monthly archives into InfluxDB
+  db migrate [--to version]             apply or revert SQLite schema migrations
+  db status                             list SQLite schema migrations
+  config print                          print the effective configuration, secrets redacted
+  config check                          validate the configuration
+
+Filters use the query parameters of the HTTP API, e.g.
+  NemWebGoApi units list --format csv region_id.eq=NSW1 fuel_source.li=Wind
+  NemWebGoApi data demand range.start=-1h region_id.eq=VIC1
+
+Every command accepts the configuration flags, see "NemWebGoApi <command> -h"
+`
+
+// errUsage is returned when a command is invoked incorrectly, usage has already been printed
+var errUsage = errors.New("usage")
+
+// Run executes the command given by args, excluding the program name, and returns the exit code
+func Run(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return serve(args)
+	}
+
+	var err error
+	switch args[0] {
+	case "serve":
+		return serve(args[1:])
+	case "units":
+		err = unitsCommand(args[1:], os.Stdout)
+	case "data":
+		err = dataCommand(args[1:], os.Stdout)
+	case "db":
+		err = dbCommand(args[1:], os.Stdout)
+	case "quality":
+		err = qualityCommand(args[1:], os.Stdout)
+	case "ingest":
+		err = ingestCommand(args[1:], os.Stdout)
+	case "backfill":
+		err = backfillCommand(args[1:], os.Stdout)
+	case "config":
+		err = configCommand(args[1:], os.Stdout)
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		return 2
+	default:
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+}
+
+func serve(args []string) int {
+	api.Init(false, args)
+	api.Run(false)
+	return 0
+}
+
+// subcommand returns the first argument if it is one of options, printing usage otherwise
+func subcommand(command string, args []string, options ...string) (string, []string, error) {
+	if len(args) > 0 {
+		for _, o := range options {
+			if args[0] == o {
+				return o, args[1:], nil
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "usage: %s %s [flags] [filters]\n", command, strings.Join(options, "|"))
+	return "", nil, errUsage
+}
+
+// loadConfig parses the configuration flags with the command's own flags on fs,
+// logging goes to stderr so it does not mix with command output
+func loadConfig(fs *flag.FlagSet, args []string) (*config.Config, error) {
+	conf, err := config.LoadFlags(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	conf.SetupLogger(os.Stderr)
+	return conf, nil
+}
+
+// parseFilters converts key=value arguments to the query parameter map used by the model layer
+func parseFilters(args []string) (map[string][]string, error) {
+	filters := make(map[string][]string)
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid filter %q, expected key=value", arg)
+		}
+		filters[parts[0]] = append(filters[parts[0]], parts[1])
+	}
+	return filters, nil
+}
+
+// stores holds the database handles opened for a command
+type stores struct {
+	SQLDb    *sql.DB
+	InfluxDB influxdb2.Client
+}
+
+// openStores opens SQLite and, if withInflux, an InfluxDB client, which needs a token
+func openStores(conf *config.Config, withInflux bool) (*stores, error) {
+	if withInflux {
+		if err := conf.RequireInflux(); err != nil {
+			return nil, err
+		}
+	}
+	db, err := sqlite.New(conf.SQLFilePath(), false)
+	if err != nil {
+		return nil, err
+	}
+	s := &stores{SQLDb: db}
+	if withInflux {
+		s.InfluxDB = influxdb.New(conf.InfluxHost(), conf.InfluxToken())
+	}
+	return s, nil
+}
+
+func (s *stores) Close() {
+	if s.InfluxDB != nil {
+		s.InfluxDB.Close()
+	}
+	s.SQLDb.Close()
+}
+
+// commandContext returns a context cancelled after timeout, zero for no timeout
+func commandContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
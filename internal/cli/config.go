@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"NemWebGoApi/api/models"
+)
+
+// configCommand handles "config print|check [flags]"
+func configCommand(args []string, w io.Writer) error {
+	action, args, err := subcommand("config", args, "print", "check")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("config "+action, flag.ContinueOnError)
+	ping := false
+	if action == "check" {
+		fs.BoolVar(&ping, "ping", false, "also check InfluxDB and SQLite are reachable")
+	}
+	conf, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if action == "print" {
+		conf.Print(w)
+		return nil
+	}
+
+	fmt.Fprintln(w, "configuration: ok")
+	if !ping {
+		return nil
+	}
+
+	failed := false
+	ctx, cancel := commandContext(conf.HealthCheckTimeout())
+	defer cancel()
+
+	db, err := openStores(conf, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if ok, err := db.InfluxDB.Ping(ctx); err != nil || !ok {
+		fmt.Fprintf(w, "influxdb: unreachable at %s: %v\n", conf.InfluxHost(), err)
+		failed = true
+	} else {
+		fmt.Fprintln(w, "influxdb: ok")
+	}
+
+	if _, err := os.Stat(conf.SQLFilePath()); err != nil {
+		fmt.Fprintf(w, "sqlite: %v\n", err)
+		failed = true
+	} else if err := models.PingUnits(ctx, db.SQLDb); err != nil {
+		fmt.Fprintf(w, "sqlite: %v\n", err)
+		failed = true
+	} else {
+		fmt.Fprintln(w, "sqlite: ok")
+	}
+
+	if failed {
+		return fmt.Errorf("config check: stores unreachable")
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"NemWebGoApi/api/models"
+	"NemWebGoApi/internal/config"
+)
+
+// dataCommand handles "data demand|rooftop|generation [flags] [filters]"
+func dataCommand(args []string, w io.Writer) error {
+	measurement, args, err := subcommand("data", args, "demand", "rooftop", "generation")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("data "+measurement, flag.ContinueOnError)
+	format := formatFlag(fs)
+	conf, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	filters, err := parseFilters(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	db, err := openStores(conf, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var out *table
+	switch measurement {
+	case "demand":
+		out, err = readDemand(conf, db, filters)
+	case "rooftop":
+		out, err = readRooftop(conf, db, filters)
+	case "generation":
+		out, err = readGeneration(conf, db, filters)
+	}
+	if err != nil {
+		return err
+	}
+	return out.write(w, *format)
+}
+
+func readDemand(conf *config.Config, db *stores, filters map[string][]string) (*table, error) {
+	ctx, cancel := commandContext(conf.DemandQueryTimeout())
+	defer cancel()
+
+	filter := models.FilterMaptoDemandFilter(ctx, filters)
+	if err := filter.Fill.Err(); err != nil {
+		return nil, err
+	}
+	data, err := models.ReadDemandData(
+		ctx,
+		db.InfluxDB.QueryAPI(conf.InfluxOrg()),
+		conf.InfluxBucket(),
+		filter,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &table{header: []string{"time", "region_id", "value"}}
+	for _, point := range data {
+		out.add(formatTime(point.Time), point.RegionID, formatValue(point.Value))
+	}
+	return out, nil
+}
+
+func readRooftop(conf *config.Config, db *stores, filters map[string][]string) (*table, error) {
+	ctx, cancel := commandContext(conf.RooftopQueryTimeout())
+	defer cancel()
+
+	filter := models.FilterMaptoRooftopFilter(ctx, filters)
+	if err := filter.Fill.Err(); err != nil {
+		return nil, err
+	}
+	data, err := models.ReadRooftapData(
+		ctx,
+		db.InfluxDB.QueryAPI(conf.InfluxOrg()),
+		conf.InfluxBucket(),
+		filter,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &table{header: []string{"time", "region_id", "value"}}
+	for _, point := range data {
+		out.add(formatTime(point.Time), point.RegionID, formatValue(point.Value))
+	}
+	return out, nil
+}
+
+func readGeneration(conf *config.Config, db *stores, filters map[string][]string) (*table, error) {
+	ctx, cancel := commandContext(conf.GenerationQueryTimeout())
+	defer cancel()
+
+	filter := models.FilterMapToGenerationFilter(ctx, filters)
+	if err := filter.Fill.Err(); err != nil {
+		return nil, err
+	}
+	out := &table{header: []string{"time", "unit", "value"}}
+	if err := filter.ResolveUnits(ctx, db.SQLDb, filters); err != nil {
+		if errors.Is(err, models.ErrNoMatchingUnits) {
+			return out, nil
+		}
+		return nil, err
+	}
+	data, err := models.ReadGenerationData(ctx, db.InfluxDB.QueryAPI(conf.InfluxOrg()), conf.InfluxBucket(), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, series := range data {
+		for _, point := range series.Data {
+			out.add(formatTime(point.Time), series.Unit, formatValue(point.Value))
+		}
+	}
+	return out, nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// formatValue formats a value, empty for the NaN of an interval filled with null
+func formatValue(v float64) string {
+	if math.IsNaN(v) {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
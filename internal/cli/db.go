@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"NemWebGoApi/internal/sqlite"
+)
+
+// dbCommand handles "db migrate [--to version]" and "db status"
+func dbCommand(args []string, w io.Writer) error {
+	action, args, err := subcommand("db", args, "migrate", "status")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("db "+action, flag.ContinueOnError)
+	to := -1
+	if action == "migrate" {
+		fs.IntVar(&to, "to", -1, "migrate up or down to this version, default the latest")
+	}
+	conf, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+
+	db, err := openStores(conf, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	if action == "status" {
+		migrations, err := sqlite.Status(ctx, db.SQLDb)
+		if err != nil {
+			return err
+		}
+		out := table{header: []string{"version", "name", "applied_at"}}
+		for _, m := range migrations {
+			appliedAt := "pending"
+			if m.Requires != "" {
+				appliedAt += ", needs " + m.Requires
+			}
+			if m.AppliedAt != nil {
+				appliedAt = formatTime(*m.AppliedAt)
+			}
+			out.add(fmt.Sprintf("%04d", m.Version), m.Name, appliedAt)
+		}
+		return out.write(w, formatTable)
+	}
+
+	latest, err := sqlite.LatestVersion()
+	if err != nil {
+		return err
+	}
+	if to < 0 || to > latest {
+		to = latest
+	}
+	run, err := sqlite.MigrateTo(ctx, db.SQLDb, to)
+	for _, m := range run {
+		fmt.Fprintf(w, "migrated %04d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "schema at version %d\n", to)
+	return nil
+}
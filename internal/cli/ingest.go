@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"NemWebGoApi/internal/influxdb"
+	"NemWebGoApi/internal/ingest"
+)
+
+// ingestCommand handles "ingest [flags] <path>...", loading NEMWEB MMS CSV files, zip archives
+// or directories of them into InfluxDB
+func ingestCommand(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	format := formatFlag(fs)
+	dryRun := fs.Bool("dry-run", false, "read the files and count points without writing them")
+	batchSize := fs.Int("batch-size", ingest.DefaultBatchSize, "points written to InfluxDB per request")
+	conf, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: ingest [--dry-run] [--batch-size n] [flags] <file|dir>...")
+		return errUsage
+	}
+
+	ingester := ingest.Ingester{BatchSize: *batchSize}
+	if !*dryRun {
+		if err := conf.RequireInflux(); err != nil {
+			return err
+		}
+		client := influxdb.New(conf.InfluxHost(), conf.InfluxToken())
+		defer client.Close()
+		ingester.Store = ingest.NewInfluxStore(client, conf.InfluxOrg(), conf.InfluxBucket())
+	}
+
+	ctx, cancel := commandContext(0)
+	defer cancel()
+
+	stats, err := ingester.Ingest(ctx, fs.Args()...)
+	out := table{header: []string{"measurement", "points"}}
+	measurements := make([]string, 0, len(stats.Points))
+	for measurement := range stats.Points {
+		measurements = append(measurements, measurement)
+	}
+	sort.Strings(measurements)
+	for _, measurement := range measurements {
+		out.add(measurement, strconv.Itoa(stats.Points[measurement]))
+	}
+	if writeErr := out.write(w, *format); writeErr != nil && err == nil {
+		err = writeErr
+	}
+
+	skipped := 0
+	for _, n := range stats.Skipped {
+		skipped += n
+	}
+	fmt.Fprintf(os.Stderr, "%d files, %d records of other tables skipped, %d invalid records\n", stats.Files, skipped, stats.Invalid)
+	if *dryRun {
+		fmt.Fprintln(os.Stderr, "dry run, nothing written")
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats accepted by --format
+const (
+	formatTable = "table"
+	formatCSV   = "csv"
+)
+
+// table is command output as a header and rows of text
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+func (t *table) add(row ...string) {
+	t.rows = append(t.rows, row)
+}
+
+// formatFlag registers --format on fs
+func formatFlag(fs *flag.FlagSet) *string {
+	return fs.String("format", formatTable, "output format, table or csv")
+}
+
+// write prints the table to w in format
+func (t *table) write(w io.Writer, format string) error {
+	switch format {
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(t.header)
+		cw.WriteAll(t.rows)
+		return cw.Error()
+	case formatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+		for _, row := range t.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown format %q, expected table or csv", format)
+	}
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"NemWebGoApi/api/models"
+)
+
+// qualitySections are the tables printed by "quality", in order
+var qualitySections = []string{"coverage", "gaps", "stale", "unknown", "suspicious"}
+
+// qualityCommand handles "quality [flags] [filters]", the /quality report as tables
+func qualityCommand(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("quality", flag.ContinueOnError)
+	format := formatFlag(fs)
+	section := fs.String("section", "", "print only one of coverage, gaps, stale, unknown or suspicious, required for csv")
+	conf, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if *section != "" && !containsSection(*section) {
+		return fmt.Errorf("unknown section %q, expected one of coverage, gaps, stale, unknown or suspicious", *section)
+	}
+	if *section == "" && *format == formatCSV {
+		return fmt.Errorf("--section is required with --format csv")
+	}
+	filters, err := parseFilters(fs.Args())
+	if err != nil {
+		return err
+	}
+	filter, err := models.ParseQualityFilterMap(filters)
+	if err != nil {
+		return err
+	}
+
+	db, err := openStores(conf, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := commandContext(conf.QualityQueryTimeout())
+	defer cancel()
+
+	report, err := models.ReadQualityReport(ctx, db.InfluxDB.QueryAPI(conf.InfluxOrg()), db.SQLDb, conf.InfluxBucket(), filter)
+	if err != nil {
+		return err
+	}
+
+	tables := qualityTables(report)
+	for i, name := range qualitySections {
+		if *section != "" && name != *section {
+			continue
+		}
+		if *section == "" {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "# %s\n", name)
+		}
+		if err := tables[name].write(w, *format); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%s to %s\n", formatTime(report.Start), formatTime(report.Stop))
+	return nil
+}
+
+func qualityTables(report *models.QualityReport) map[string]*table {
+	coverage := &table{header: []string{"measurement", "region_id", "interval", "expected", "missing"}}
+	for _, c := range report.Coverage {
+		coverage.add(c.Measurement, c.RegionID, c.Interval, strconv.Itoa(c.Expected), strconv.Itoa(c.Missing))
+	}
+	gaps := &table{header: []string{"measurement", "region_id", "start", "stop", "intervals"}}
+	for _, g := range report.Gaps {
+		gaps.add(g.Measurement, g.RegionID, formatTime(g.Start), formatTime(g.Stop), strconv.Itoa(g.Intervals))
+	}
+	stale := &table{header: []string{"duid", "station_name", "region_id", "last_seen"}}
+	for _, u := range report.StaleUnits {
+		lastSeen := ""
+		if u.LastSeen != nil {
+			lastSeen = formatTime(*u.LastSeen)
+		}
+		stale.add(u.DuID, u.StationName, u.RegionID, lastSeen)
+	}
+	unknown := &table{header: []string{"duid", "last_seen"}}
+	for _, u := range report.UnknownUnits {
+		unknown.add(u.DuID, formatTime(u.LastSeen))
+	}
+	suspicious := &table{header: []string{"duid", "reason", "value", "time", "max_capacity"}}
+	for _, v := range report.Suspicious {
+		suspicious.add(v.DuID, v.Reason, formatValue(v.Value), formatTime(v.Time), strconv.FormatInt(v.MaxCapacity, 10))
+	}
+	return map[string]*table{"coverage": coverage, "gaps": gaps, "stale": stale, "unknown": unknown, "suspicious": suspicious}
+}
+
+func containsSection(section string) bool {
+	for _, s := range qualitySections {
+		if s == section {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"NemWebGoApi/api/models"
+)
+
+// unitsCommand handles "units list [flags] [filters]", "units import-locations [flags] <file>"
+// and "units import-registration [flags] <file>"
+func unitsCommand(args []string, w io.Writer) error {
+	command, args, err := subcommand("units", args, "list", "import-locations", "import-registration")
+	if err != nil {
+		return err
+	}
+	switch command {
+	case "import-locations":
+		return importLocations(args, w)
+	case "import-registration":
+		return importRegistration(args, w)
+	}
+
+	fs := flag.NewFlagSet("units list", flag.ContinueOnError)
+	format := formatFlag(fs)
+	conf, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	filters, err := parseFilters(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	db, err := openStores(conf, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := commandContext(conf.UnitsQueryTimeout())
+	defer cancel()
+
+	unitFilter := models.ParseUnitFilterMap(filters)
+	if err := unitFilter.Location.Err(); err != nil {
+		return err
+	}
+	unit := models.Unit{}
+	units, err := unit.ReadAll(ctx, db.SQLDb, unitFilter)
+	if err != nil {
+		return err
+	}
+
+	out := table{header: []string{"duid", "station_name", "region_id", "fuel_source", "technology_type", "max_capacity", "latitude", "longitude", "state"}}
+	for _, u := range *units {
+		out.add(u.DuID, u.StationName, u.RegionID, u.FuelSource, u.TechnologyType, strconv.FormatInt(u.MaxCapacity, 10),
+			formatCoordinate(u.Latitude), formatCoordinate(u.Longitude), u.State)
+	}
+	return out.write(w, *format)
+}
+
+// importLocations handles "units import-locations [flags] <file>", a CSV of duid, latitude,
+// longitude and state, "-" reads stdin
+func importLocations(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("units import-locations", flag.ContinueOnError)
+	format := formatFlag(fs)
+	conf, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: units import-locations [flags] <file.csv>")
+		return errUsage
+	}
+
+	in := io.Reader(os.Stdin)
+	if fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	locations, err := models.ParseUnitLocationsCSV(in)
+	if err != nil {
+		return err
+	}
+
+	db, err := openStores(conf, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := commandContext(0)
+	defer cancel()
+
+	results, err := models.ImportUnitLocations(ctx, db.SQLDb, locations, "cli")
+	out := table{header: []string{"duid", "result", "problem"}}
+	for _, result := range results {
+		out.add(result.DuID, result.Result, result.Problem)
+	}
+	if writeErr := out.write(w, *format); writeErr != nil && err == nil {
+		err = writeErr
+	}
+	return err
+}
+
+// importRegistration handles "units import-registration [flags] <file>", a CSV or XLSX copy of AEMO's
+// NEM Registration and Exemption List, "-" reads stdin
+// Without --apply the diff is printed and nothing is written
+func importRegistration(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("units import-registration", flag.ContinueOnError)
+	format := formatFlag(fs)
+	apply := fs.Bool("apply", false, "write the inserts and updates, otherwise only print the diff")
+	sheet := fs.String("sheet", "", "XLSX sheet to read, by default the generators sheet")
+	conf, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: units import-registration [--apply] [--sheet name] [flags] <file.csv|file.xlsx>")
+		return errUsage
+	}
+
+	var data []byte
+	if fs.Arg(0) == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	rows, err := models.ParseRegistration(data, *sheet)
+	if err != nil {
+		return err
+	}
+
+	db, err := openStores(conf, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := commandContext(0)
+	defer cancel()
+
+	result, err := models.ImportRegistration(ctx, db.SQLDb, rows, *apply, "cli")
+	if err != nil {
+		return err
+	}
+
+	out := table{header: []string{"duid", "action", "lines", "changes", "problem"}}
+	for _, change := range result.Changes {
+		lines := make([]string, 0, len(change.Lines))
+		for _, line := range change.Lines {
+			lines = append(lines, strconv.Itoa(line))
+		}
+		fields := make([]string, 0, len(change.Changes))
+		for field, c := range change.Changes {
+			fields = append(fields, fmt.Sprintf("%s: %v -> %v", field, c.From, c.To))
+		}
+		sort.Strings(fields)
+		out.add(change.DuID, change.Action, strings.Join(lines, " "), strings.Join(fields, "; "), change.Problem)
+	}
+	if err := out.write(w, *format); err != nil {
+		return err
+	}
+
+	summary := "dry run, use --apply to write: %d to insert, %d to update, %d unchanged, %d conflicts, %d invalid\n"
+	if result.Applied {
+		summary = "%d inserted, %d updated, %d unchanged, %d conflicts, %d invalid\n"
+	}
+	fmt.Fprintf(os.Stderr, summary, result.Inserted, result.Updated, result.Unchanged, result.Conflicts, result.Invalid)
+	return nil
+}
+
+func formatCoordinate(c *float64) string {
+	if c == nil {
+		return ""
+	}
+	return formatValue(*c)
+}
@@ -1,75 +1,124 @@
 package config
 
 import (
-	"errors"
 	"fmt"
+	"io"
 	"os"
-	"strconv"
+	"strings"
+	"time"
 
-	"github.com/joho/godotenv"
 	log "github.com/sirupsen/logrus"
 )
 
+// CORSOptions is the CORS policy applied to a set of routes
+type CORSOptions struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           int
+}
+
 // Config is a struct for keeping all configuration variables
 type Config struct {
-	sqlitePath   string
-	influxURL    string
-	influxToken  string
-	influxOrg    string
-	influxBucket string
-	apiPort      string
-	logLevel     string
-	testing      bool
-}
-
-// New Loads a new config
-func New() *Config {
-	if _, err := os.Stat("/.dockerenv"); errors.Is(err, os.ErrNotExist) {
-		// path/to/whatever does not exist
-		err = godotenv.Load()
-		if err != nil {
-			fmt.Printf("Error getting env, %v", err)
-			os.Exit(1)
-		} else {
-			fmt.Println(".env File Read")
-			log.Infoln(".env File Read")
-		}
-	}
+	flags   map[string]string // values given by command line flags keyed by setting key, kept for reloads
+	file    string            // config file path, empty if none
+	raw     map[string]string // effective value of each setting as text, keyed by setting key
+	sources map[string]string // where each effective value came from
+
+	sqlitePath        string
+	sqliteAutoMigrate bool
+	influxURL         string
+	influxToken       string
+	influxOrg         string
+	influxBucket      string
+	apiPort           string
+	logLevel          string
+	logFormat         string
+	testing           bool
+
+	watchInterval time.Duration
+
+	unitsQueryTimeout             time.Duration
+	demandQueryTimeout            time.Duration
+	rooftopQueryTimeout           time.Duration
+	generationQueryTimeout        time.Duration
+	generationGroupedQueryTimeout time.Duration
+	qualityQueryTimeout           time.Duration
+
+	httpReadTimeout       time.Duration
+	httpReadHeaderTimeout time.Duration
+	httpWriteTimeout      time.Duration
+	httpIdleTimeout       time.Duration
+	shutdownTimeout       time.Duration
+
+	healthCheckTimeout time.Duration
+	dataStaleAfter     time.Duration
+
+	unitCacheTTL time.Duration
+
+	tracingExporter     string
+	tracingServiceName  string
+	tracingSampleRatio  float64
+	tracingOTLPEndpoint string
+	tracingOTLPInsecure bool
+	tracingQueryText    string
+
+	authEnabled bool
+	adminAPIKey string
 
-	conf := &Config{}
+	rateLimitRPS      float64
+	rateLimitBurst    int
+	trustProxyHeaders bool
+	queryCostBudget   int64
+	queryCostMode     string
 
-	conf.sqlitePath = parseEnvString("SQLITE_PATH", "/data/database.sqlite")
-	conf.influxURL = parseEnvString("INFLUX_URL", "http://localhost:8086")
-	conf.influxToken = parseEnvString("INFLUX_TOKEN", "aaaaaaa")
-	conf.influxOrg = parseEnvString("INFLUX_ORG", "nema")
-	conf.influxBucket = parseEnvString("INFLUX_BUCKET", "nema_bucket")
-	conf.apiPort = parseEnvString("API_PORT", "3005")
-	conf.logLevel = parseEnvString("LOG_LEVEL", "info")
-	conf.testing, _ = strconv.ParseBool(parseEnvString("TESTING", "False"))
+	cors       CORSOptions
+	corsRoutes map[string]CORSOptions
+}
+
+// New loads the configuration from the config file, environment and command line flags
+// and configures logging, see Load for precedence
+func New(args []string) (*Config, error) {
+	conf, err := Load(args)
+	if err != nil {
+		return nil, err
+	}
+
+	setupLogger(conf.logLevel, conf.logFormat, os.Stdout)
 
 	if conf.testing {
 		log.Warnln("TESTING")
 	}
+	if conf.file != "" {
+		log.Infoln("Config File Read:", conf.file)
+	}
+	if log.IsLevelEnabled(log.DebugLevel) {
+		var effective strings.Builder
+		conf.Print(&effective)
+		log.Debugln("Effective Configuration:\n" + effective.String())
+	}
 
-	setupLogger(conf.logLevel)
-
-	return conf
+	return conf, nil
 }
 
-func parseEnvString(key string, defaultVal string) string {
-	if val, ok := os.LookupEnv(key); ok {
-		return val
-	}
-	return defaultVal
+// SetupLogger configures the global logger from the log settings, writing to w
+func (c *Config) SetupLogger(w io.Writer) {
+	setupLogger(c.logLevel, c.logFormat, w)
 }
 
-func setupLogger(logLevel string) {
-	log.SetOutput(os.Stdout)
+func setupLogger(logLevel string, logFormat string, w io.Writer) {
+	log.SetOutput(w)
 
-	log.SetFormatter(&log.TextFormatter{
-		DisableColors: false,
-		FullTimestamp: true,
-	})
+	if logFormat == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+	} else {
+		log.SetFormatter(&log.TextFormatter{
+			DisableColors: false,
+			FullTimestamp: true,
+		})
+	}
 
 	switch logLevel {
 	case "trace":
@@ -84,12 +133,25 @@ func setupLogger(logLevel string) {
 	case "warn":
 		log.Warnln("Log Level: Warn")
 		log.SetLevel(log.WarnLevel)
+	case "error":
+		log.Warnln("Log Level: Error")
+		log.SetLevel(log.ErrorLevel)
 	case "fatal":
 		log.Warnln("Log Level: Fatal")
 		log.SetLevel(log.FatalLevel)
 	}
 }
 
+// File returns the path of the config file, empty if none was given
+func (c *Config) File() string {
+	return c.file
+}
+
+// WatchInterval returns how often the config file is checked for changes, zero disables watching
+func (c *Config) WatchInterval() time.Duration {
+	return c.watchInterval
+}
+
 // Testing returns a boolean for testing status
 func (c *Config) Testing() bool {
 	return c.testing
@@ -100,6 +162,11 @@ func (c *Config) SQLFilePath() string {
 	return c.sqlitePath
 }
 
+// SQLiteAutoMigrate returns true if pending schema migrations are applied on startup
+func (c *Config) SQLiteAutoMigrate() bool {
+	return c.sqliteAutoMigrate
+}
+
 // Port returns the port for api access
 func (c *Config) Port() string {
 	return c.apiPort
@@ -113,6 +180,15 @@ func (c *Config) InfluxToken() string {
 	return c.influxToken
 }
 
+// RequireInflux returns a *ValidationError if InfluxDB cannot be queried with the configuration,
+// checked only where a client is opened so commands that only use SQLite run without a token
+func (c *Config) RequireInflux() error {
+	if c.influxToken == "" {
+		return &ValidationError{Problems: []string{fmt.Sprintf("INFLUX_TOKEN (influx.token, from %s): is required to query InfluxDB", c.sources["influx.token"])}}
+	}
+	return nil
+}
+
 func (c *Config) InfluxBucket() string {
 	return c.influxBucket
 }
@@ -120,3 +196,150 @@ func (c *Config) InfluxBucket() string {
 func (c *Config) InfluxOrg() string {
 	return c.influxOrg
 }
+
+// UnitsQueryTimeout returns the maximum time allowed for /units queries
+func (c *Config) UnitsQueryTimeout() time.Duration {
+	return c.unitsQueryTimeout
+}
+
+// DemandQueryTimeout returns the maximum time allowed for /data/demand queries
+func (c *Config) DemandQueryTimeout() time.Duration {
+	return c.demandQueryTimeout
+}
+
+// RooftopQueryTimeout returns the maximum time allowed for /data/rooftop queries
+func (c *Config) RooftopQueryTimeout() time.Duration {
+	return c.rooftopQueryTimeout
+}
+
+// GenerationQueryTimeout returns the maximum time allowed for /data/generation queries
+func (c *Config) GenerationQueryTimeout() time.Duration {
+	return c.generationQueryTimeout
+}
+
+// GenerationGroupedQueryTimeout returns the maximum time allowed for /data/generation/grouped queries
+func (c *Config) GenerationGroupedQueryTimeout() time.Duration {
+	return c.generationGroupedQueryTimeout
+}
+
+// QualityQueryTimeout returns the maximum time allowed for /quality queries
+func (c *Config) QualityQueryTimeout() time.Duration {
+	return c.qualityQueryTimeout
+}
+
+// HTTPReadTimeout returns the maximum duration for reading an entire request
+func (c *Config) HTTPReadTimeout() time.Duration {
+	return c.httpReadTimeout
+}
+
+// HTTPReadHeaderTimeout returns the maximum duration for reading request headers
+func (c *Config) HTTPReadHeaderTimeout() time.Duration {
+	return c.httpReadHeaderTimeout
+}
+
+// HTTPWriteTimeout returns the maximum duration before timing out writing a response,
+// should be longer than the largest query timeout
+func (c *Config) HTTPWriteTimeout() time.Duration {
+	return c.httpWriteTimeout
+}
+
+// HTTPIdleTimeout returns the maximum time to wait for the next request on a keep-alive connection
+func (c *Config) HTTPIdleTimeout() time.Duration {
+	return c.httpIdleTimeout
+}
+
+// ShutdownTimeout returns how long in-flight requests are given to complete on shutdown
+func (c *Config) ShutdownTimeout() time.Duration {
+	return c.shutdownTimeout
+}
+
+// HealthCheckTimeout returns the maximum time each readiness dependency check may take
+func (c *Config) HealthCheckTimeout() time.Duration {
+	return c.healthCheckTimeout
+}
+
+// DataStaleAfter returns the age after which the latest demand point is reported as stale
+func (c *Config) DataStaleAfter() time.Duration {
+	return c.dataStaleAfter
+}
+
+// UnitCacheTTL returns how long SQLite unit lookups are cached, zero disables the cache
+func (c *Config) UnitCacheTTL() time.Duration {
+	return c.unitCacheTTL
+}
+
+// TracingExporter returns where spans are exported, none, stdout or otlp
+func (c *Config) TracingExporter() string {
+	return c.tracingExporter
+}
+
+// TracingServiceName returns the service.name resource attribute for spans
+func (c *Config) TracingServiceName() string {
+	return c.tracingServiceName
+}
+
+// TracingSampleRatio returns the fraction of new traces that are sampled
+func (c *Config) TracingSampleRatio() float64 {
+	return c.tracingSampleRatio
+}
+
+// TracingOTLPEndpoint returns the host:port of the OTLP HTTP collector,
+// empty to use the standard OTEL_EXPORTER_OTLP_* variables
+func (c *Config) TracingOTLPEndpoint() string {
+	return c.tracingOTLPEndpoint
+}
+
+// TracingOTLPInsecure returns true if the OTLP collector is reached over plain HTTP
+func (c *Config) TracingOTLPInsecure() bool {
+	return c.tracingOTLPInsecure
+}
+
+// TracingQueryText returns how query text is attached to spans, full, redacted or none
+func (c *Config) TracingQueryText() string {
+	return c.tracingQueryText
+}
+
+// AuthEnabled returns true if /units and /data require an API key
+func (c *Config) AuthEnabled() bool {
+	return c.authEnabled
+}
+
+// AdminAPIKey returns the bootstrap key granted the admin scope, empty if unset
+func (c *Config) AdminAPIKey() string {
+	return c.adminAPIKey
+}
+
+// RateLimitRPS returns the sustained requests per second allowed per client, zero disables limiting
+func (c *Config) RateLimitRPS() float64 {
+	return c.rateLimitRPS
+}
+
+// RateLimitBurst returns the number of requests a client may make in a burst
+func (c *Config) RateLimitBurst() int {
+	return c.rateLimitBurst
+}
+
+// TrustProxyHeaders returns true if X-Forwarded-For identifies the client
+func (c *Config) TrustProxyHeaders() bool {
+	return c.trustProxyHeaders
+}
+
+// QueryCostBudget returns the maximum estimated points a single query may read, zero disables the budget
+func (c *Config) QueryCostBudget() int64 {
+	return c.queryCostBudget
+}
+
+// QueryCostMode returns what happens to queries over budget, reject or downsample
+func (c *Config) QueryCostMode() string {
+	return c.queryCostMode
+}
+
+// CORS returns the default CORS policy
+func (c *Config) CORS() CORSOptions {
+	return c.cors
+}
+
+// CORSRoutes returns CORS policies keyed by path prefix that override the default
+func (c *Config) CORSRoutes() map[string]CORSOptions {
+	return c.corsRoutes
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInfluxTokenRequiredOnlyForInflux(t *testing.T) {
+	t.Setenv("INFLUX_TOKEN", "")
+
+	conf, err := Load([]string{"--sqlite-path", "units.sqlite"})
+	if err != nil {
+		t.Fatalf("Load without a token: %v", err)
+	}
+	var invalid *ValidationError
+	if err := conf.RequireInflux(); !errors.As(err, &invalid) {
+		t.Fatalf("RequireInflux without a token = %v, want a *ValidationError", err)
+	}
+
+	conf, err = Load([]string{"--sqlite-path", "units.sqlite", "--influx-token", "secret"})
+	if err != nil {
+		t.Fatalf("Load with a token: %v", err)
+	}
+	if err := conf.RequireInflux(); err != nil {
+		t.Fatalf("RequireInflux with a token = %v, want nil", err)
+	}
+}
@@ -0,0 +1,252 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v2"
+)
+
+// Where the effective value of a setting came from, in increasing precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+const redacted = "******"
+
+// ValidationError lists every problem found while loading configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Load builds the configuration from defaults, then the config file, then environment variables,
+// then command line flags, validating every value
+// The config file is given by --config or CONFIG_FILE and may be YAML or TOML
+// A .env file in the working directory is loaded into the environment if present
+func Load(args []string) (*Config, error) {
+	return LoadFlags(flag.NewFlagSet("nemweb-api", flag.ContinueOnError), args)
+}
+
+// LoadFlags is Load with the configuration flags registered on fs,
+// so commands can define their own flags, fs.Args() holds the remaining arguments
+func LoadFlags(fs *flag.FlagSet, args []string) (*Config, error) {
+	if err := loadDotEnv(); err != nil {
+		return nil, err
+	}
+
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	flagVals := make(map[string]*string)
+	for _, s := range settings {
+		flagVals[s.key] = fs.String(s.flagName(), "", fmt.Sprintf("%s (env %s)", s.help, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	flags := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flagName() == f.Name {
+				flags[s.key] = *flagVals[s.key]
+			}
+		}
+	})
+	return build(*configPath, flags)
+}
+
+// build layers defaults, the config file, environment variables and flag values keyed by setting key
+func build(configPath string, flags map[string]string) (*Config, error) {
+	problems := make([]string, 0)
+
+	fileVals := make(map[string]string)
+	if configPath != "" {
+		var err error
+		fileVals, err = readFile(configPath)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	conf := &Config{
+		flags:   flags,
+		file:    configPath,
+		raw:     make(map[string]string),
+		sources: make(map[string]string),
+	}
+
+	for _, s := range settings {
+		val, source := s.def, SourceDefault
+		if v, ok := fileVals[s.key]; ok {
+			val, source = v, SourceFile
+		}
+		if v, ok := os.LookupEnv(s.env); ok {
+			val, source = v, SourceEnv
+		}
+		if v, ok := flags[s.key]; ok {
+			val, source = v, SourceFlag
+		}
+
+		conf.raw[s.key] = val
+		conf.sources[s.key] = source
+		if err := s.parse(conf, val); err != nil {
+			problems = append(problems, fmt.Sprintf("%s (%s, from %s): %v", s.env, s.key, source, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return conf, nil
+}
+
+func loadDotEnv() error {
+	if _, err := os.Stat(".env"); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err := godotenv.Load(); err != nil {
+		return fmt.Errorf("config.Load: error reading .env: %w", err)
+	}
+	return nil
+}
+
+// readFile reads a YAML or TOML config file into values keyed by setting key
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+
+	var tree map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var raw map[interface{}]interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+		tree = stringKeys(raw)
+	case ".toml":
+		if _, err := toml.Decode(string(data), &tree); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported extension, expected .yaml, .yml or .toml", path)
+	}
+
+	known := make(map[string]bool)
+	for _, s := range settings {
+		known[s.key] = true
+	}
+
+	values := make(map[string]string)
+	unknown := make([]string, 0)
+	flatten("", tree, known, values, &unknown)
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return values, fmt.Errorf("config file %s: unknown settings %s", path, strings.Join(unknown, ", "))
+	}
+	return values, nil
+}
+
+// flatten walks nested sections until it reaches a known setting key,
+// converting the value at that key to the same text form used by environment variables
+func flatten(prefix string, value interface{}, known map[string]bool, out map[string]string, unknown *[]string) {
+	if known[prefix] {
+		out[prefix] = stringify(value)
+		return
+	}
+
+	section, ok := asMap(value)
+	if !ok {
+		*unknown = append(*unknown, prefix)
+		return
+	}
+	for k, v := range section {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		flatten(key, v, known, out, unknown)
+	}
+}
+
+// stringify converts a file value to text, lists are comma separated
+// and maps (cors.routes) become "key=value;key=value"
+func stringify(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		items := make([]string, 0, len(list))
+		for _, item := range list {
+			items = append(items, stringify(item))
+		}
+		return strings.Join(items, ",")
+	}
+	if m, ok := asMap(value); ok {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		items := make([]string, 0, len(keys))
+		for _, k := range keys {
+			items = append(items, k+"="+stringify(m[k]))
+		}
+		return strings.Join(items, ";")
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func asMap(value interface{}) (map[string]interface{}, bool) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		return stringKeys(m), true
+	}
+	return nil, false
+}
+
+func stringKeys(m map[interface{}]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[fmt.Sprintf("%v", k)] = v
+	}
+	return out
+}
+
+// Print writes the effective configuration and where each value came from,
+// secrets are redacted
+func (c *Config) Print(w io.Writer) {
+	if c.file != "" {
+		fmt.Fprintf(w, "# config file: %s\n", c.file)
+	}
+	for _, s := range settings {
+		source := c.sources[s.key]
+		if source == SourceEnv {
+			source += " " + s.env
+		}
+		fmt.Fprintf(w, "%-32s = %-40s # %s\n", s.key, c.display(s), source)
+	}
+}
+
+// display returns the raw value of a setting, redacted if secret
+func (c *Config) display(s setting) string {
+	val := c.raw[s.key]
+	if s.secret && val != "" {
+		return redacted
+	}
+	return val
+}
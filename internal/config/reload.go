@@ -0,0 +1,103 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Changes lists the settings that differ after a reload, as "key: old -> new" with secrets redacted
+type Changes struct {
+	Applied         []string // settings now in effect
+	RestartRequired []string // settings that keep their current value until restart
+	Logging         bool     // the log level or format changed, the caller applies it with SetupLogger
+}
+
+// Empty returns true if nothing changed
+func (c *Changes) Empty() bool {
+	return len(c.Applied) == 0 && len(c.RestartRequired) == 0
+}
+
+// Reload loads the configuration again from the same config file, environment and flag values
+// Returns a new Config with changed reloadable settings applied and every other setting
+// kept at its current value, neither the receiver nor the global logger is modified
+// If the new configuration is invalid nothing is applied and the error lists every problem
+func (c *Config) Reload() (*Config, *Changes, error) {
+	next, err := build(c.file, c.flags)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes := &Changes{Applied: make([]string, 0), RestartRequired: make([]string, 0)}
+	for _, s := range settings {
+		if next.raw[s.key] == c.raw[s.key] {
+			continue
+		}
+		change := fmt.Sprintf("%s: %s -> %s", s.key, c.display(s), next.display(s))
+		if s.reload {
+			changes.Applied = append(changes.Applied, change)
+			continue
+		}
+
+		changes.RestartRequired = append(changes.RestartRequired, change)
+		if err := s.parse(next, c.raw[s.key]); err != nil {
+			return nil, nil, fmt.Errorf("config.Reload: restoring %s: %w", s.key, err)
+		}
+		next.raw[s.key] = c.raw[s.key]
+		next.sources[s.key] = c.sources[s.key]
+	}
+
+	changes.Logging = next.logLevel != c.logLevel || next.logFormat != c.logFormat
+	return next, changes, nil
+}
+
+// Watch polls the config file every interval and sends on the returned channel when its
+// modification time or size changes, the channel is closed when ctx is done
+// Nothing is sent if there is no config file or the interval is zero
+func (c *Config) Watch(ctx context.Context, interval time.Duration) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	if c.file == "" || interval <= 0 {
+		go func() {
+			<-ctx.Done()
+			close(changed)
+		}()
+		return changed
+	}
+
+	go func() {
+		defer close(changed)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last, _ := os.Stat(c.file)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(c.file)
+			if err != nil {
+				if last != nil {
+					log.Warnln("Config File Unreadable:", err)
+				}
+				last = nil
+				continue
+			}
+			if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+				continue
+			}
+			last = info
+
+			select {
+			case changed <- struct{}{}:
+			default: // a reload is already pending
+			}
+		}
+	}()
+	return changed
+}
@@ -0,0 +1,282 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting describes a single configuration value and every place it can be set,
+// from lowest to highest precedence: default, config file, environment variable, command line flag
+type setting struct {
+	env    string // environment variable, e.g. INFLUX_TOKEN
+	key    string // dotted key in the config file, e.g. influx.token, the flag is derived from it
+	def    string // default as text, empty for none
+	help   string
+	secret bool // redacted when printed or logged
+	reload bool // applied on reload, otherwise a change needs a restart
+	parse  func(c *Config, val string) error
+}
+
+// flagName returns the command line flag for a setting, e.g. influx.token becomes influx-token
+func (s setting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.key)
+}
+
+// settings lists every configuration value, the order is used when printing
+var settings = []setting{
+	{env: "SQLITE_PATH", key: "sqlite.path", def: "/data/database.sqlite", help: "path to the units SQLite database",
+		parse: stringField(func(c *Config) *string { return &c.sqlitePath }, required)},
+	{env: "SQLITE_AUTO_MIGRATE", key: "sqlite.auto_migrate", def: "true", help: "apply pending schema migrations on startup",
+		parse: boolField(func(c *Config) *bool { return &c.sqliteAutoMigrate })},
+	{env: "INFLUX_URL", key: "influx.url", def: "http://localhost:8086", help: "InfluxDB server URL",
+		parse: stringField(func(c *Config) *string { return &c.influxURL }, validURL)},
+	{env: "INFLUX_TOKEN", key: "influx.token", help: "InfluxDB API token", secret: true,
+		parse: stringField(func(c *Config) *string { return &c.influxToken })},
+	{env: "INFLUX_ORG", key: "influx.org", def: "nema", help: "InfluxDB organisation",
+		parse: stringField(func(c *Config) *string { return &c.influxOrg }, required)},
+	{env: "INFLUX_BUCKET", key: "influx.bucket", def: "nema_bucket", help: "InfluxDB bucket",
+		parse: stringField(func(c *Config) *string { return &c.influxBucket }, required)},
+	{env: "API_PORT", key: "http.port", def: "3005", help: "port the API listens on",
+		parse: stringField(func(c *Config) *string { return &c.apiPort }, validPort)},
+	{env: "LOG_LEVEL", key: "log.level", def: "info", help: "trace, debug, info, warn, error or fatal", reload: true,
+		parse: stringField(func(c *Config) *string { return &c.logLevel }, oneOf(logLevels...))},
+	{env: "CONFIG_WATCH_INTERVAL", key: "config.watch_interval", def: "5s", help: "how often the config file is checked for changes, 0 disables",
+		parse: durationField(func(c *Config) *time.Duration { return &c.watchInterval })},
+	{env: "LOG_FORMAT", key: "log.format", def: "text", help: "text or json", reload: true,
+		parse: stringField(func(c *Config) *string { return &c.logFormat }, oneOf("text", "json"))},
+	{env: "TESTING", key: "testing", def: "false", help: "testing mode",
+		parse: boolField(func(c *Config) *bool { return &c.testing })},
+
+	{env: "UNITS_QUERY_TIMEOUT", key: "timeouts.units", def: "5s", help: "/units query timeout", reload: true,
+		parse: durationField(func(c *Config) *time.Duration { return &c.unitsQueryTimeout })},
+	{env: "DEMAND_QUERY_TIMEOUT", key: "timeouts.demand", def: "30s", help: "/data/demand query timeout", reload: true,
+		parse: durationField(func(c *Config) *time.Duration { return &c.demandQueryTimeout })},
+	{env: "ROOFTOP_QUERY_TIMEOUT", key: "timeouts.rooftop", def: "30s", help: "/data/rooftop query timeout", reload: true,
+		parse: durationField(func(c *Config) *time.Duration { return &c.rooftopQueryTimeout })},
+	{env: "GENERATION_QUERY_TIMEOUT", key: "timeouts.generation", def: "60s", help: "/data/generation query timeout", reload: true,
+		parse: durationField(func(c *Config) *time.Duration { return &c.generationQueryTimeout })},
+	{env: "GENERATION_GROUPED_QUERY_TIMEOUT", key: "timeouts.generation_grouped", def: "60s", help: "/data/generation/grouped query timeout", reload: true,
+		parse: durationField(func(c *Config) *time.Duration { return &c.generationGroupedQueryTimeout })},
+	{env: "QUALITY_QUERY_TIMEOUT", key: "timeouts.quality", def: "60s", help: "/quality query timeout", reload: true,
+		parse: durationField(func(c *Config) *time.Duration { return &c.qualityQueryTimeout })},
+
+	{env: "HTTP_READ_TIMEOUT", key: "http.read_timeout", def: "10s", help: "maximum time to read a request",
+		parse: durationField(func(c *Config) *time.Duration { return &c.httpReadTimeout })},
+	{env: "HTTP_READ_HEADER_TIMEOUT", key: "http.read_header_timeout", def: "5s", help: "maximum time to read request headers",
+		parse: durationField(func(c *Config) *time.Duration { return &c.httpReadHeaderTimeout })},
+	{env: "HTTP_WRITE_TIMEOUT", key: "http.write_timeout", def: "90s", help: "maximum time to write a response",
+		parse: durationField(func(c *Config) *time.Duration { return &c.httpWriteTimeout })},
+	{env: "HTTP_IDLE_TIMEOUT", key: "http.idle_timeout", def: "120s", help: "keep-alive idle timeout",
+		parse: durationField(func(c *Config) *time.Duration { return &c.httpIdleTimeout })},
+	{env: "SHUTDOWN_TIMEOUT", key: "http.shutdown_timeout", def: "30s", help: "time given to in-flight requests on shutdown",
+		parse: durationField(func(c *Config) *time.Duration { return &c.shutdownTimeout })},
+
+	{env: "HEALTH_CHECK_TIMEOUT", key: "health.check_timeout", def: "5s", help: "maximum time for each readiness check", reload: true,
+		parse: durationField(func(c *Config) *time.Duration { return &c.healthCheckTimeout })},
+	{env: "DATA_STALE_AFTER", key: "health.data_stale_after", def: "15m", help: "age at which demand data is reported stale", reload: true,
+		parse: durationField(func(c *Config) *time.Duration { return &c.dataStaleAfter })},
+
+	{env: "UNIT_CACHE_TTL", key: "cache.unit_ttl", def: "0", help: "unit lookup cache TTL, 0 disables", reload: true,
+		parse: durationField(func(c *Config) *time.Duration { return &c.unitCacheTTL })},
+
+	{env: "TRACING_EXPORTER", key: "tracing.exporter", def: "none", help: "none, stdout or otlp",
+		parse: stringField(func(c *Config) *string { return &c.tracingExporter }, oneOf("none", "stdout", "otlp"))},
+	{env: "TRACING_SERVICE_NAME", key: "tracing.service_name", def: "nemweb-api", help: "service.name of exported spans",
+		parse: stringField(func(c *Config) *string { return &c.tracingServiceName }, required)},
+	{env: "TRACING_SAMPLE_RATIO", key: "tracing.sample_ratio", def: "1", help: "fraction of traces sampled, 0 to 1",
+		parse: floatField(func(c *Config) *float64 { return &c.tracingSampleRatio }, 0, 1)},
+	{env: "TRACING_OTLP_ENDPOINT", key: "tracing.otlp_endpoint", help: "host:port of the OTLP HTTP collector",
+		parse: stringField(func(c *Config) *string { return &c.tracingOTLPEndpoint })},
+	{env: "TRACING_OTLP_INSECURE", key: "tracing.otlp_insecure", def: "false", help: "reach the collector over plain HTTP",
+		parse: boolField(func(c *Config) *bool { return &c.tracingOTLPInsecure })},
+	{env: "TRACING_QUERY_TEXT", key: "tracing.query_text", def: "redacted", help: "full, redacted or none",
+		parse: stringField(func(c *Config) *string { return &c.tracingQueryText }, oneOf("full", "redacted", "none"))},
+
+	{env: "AUTH_ENABLED", key: "auth.enabled", def: "false", help: "require API keys for /units and /data", reload: true,
+		parse: boolField(func(c *Config) *bool { return &c.authEnabled })},
+	{env: "ADMIN_API_KEY", key: "auth.admin_key", help: "bootstrap key with the admin scope", secret: true, reload: true,
+		parse: stringField(func(c *Config) *string { return &c.adminAPIKey })},
+
+	{env: "RATE_LIMIT_RPS", key: "rate_limit.rps", def: "10", help: "requests per second per client, 0 disables", reload: true,
+		parse: floatField(func(c *Config) *float64 { return &c.rateLimitRPS }, 0, -1)},
+	{env: "RATE_LIMIT_BURST", key: "rate_limit.burst", def: "20", help: "requests allowed in a burst", reload: true,
+		parse: intField(func(c *Config) *int { return &c.rateLimitBurst }, 1)},
+	{env: "TRUST_PROXY_HEADERS", key: "rate_limit.trust_proxy_headers", def: "false", help: "identify clients by X-Forwarded-For",
+		parse: boolField(func(c *Config) *bool { return &c.trustProxyHeaders })},
+	{env: "QUERY_COST_BUDGET", key: "query_cost.budget", def: "1000000", help: "maximum estimated points per query, 0 disables", reload: true,
+		parse: int64Field(func(c *Config) *int64 { return &c.queryCostBudget }, 0)},
+	{env: "QUERY_COST_MODE", key: "query_cost.mode", def: "reject", help: "reject or downsample", reload: true,
+		parse: stringField(func(c *Config) *string { return &c.queryCostMode }, oneOf("reject", "downsample"))},
+
+	{env: "CORS_ALLOWED_ORIGINS", key: "cors.allowed_origins", help: "origins allowed by default, one * wildcard per origin", reload: true,
+		def:   "http://127.0.0.1:3005,http://127.0.0.1:3000,http://127.0.0.1,https://aemodash.com,http://localhost:3005,http://localhost:3000,http://localhost",
+		parse: listField(func(c *Config) *[]string { return &c.cors.AllowedOrigins })},
+	{env: "CORS_ALLOWED_METHODS", key: "cors.allowed_methods", def: "GET,OPTIONS,POST,DELETE,PUT,PATCH", help: "methods allowed cross origin", reload: true,
+		parse: listField(func(c *Config) *[]string { return &c.cors.AllowedMethods })},
+	{env: "CORS_ALLOWED_HEADERS", key: "cors.allowed_headers", def: "Content-Type,Origin,Accept,Authorization,X-Request-ID,If-Match", help: "request headers allowed cross origin", reload: true,
+		parse: listField(func(c *Config) *[]string { return &c.cors.AllowedHeaders })},
+	{env: "CORS_EXPOSED_HEADERS", key: "cors.exposed_headers", help: "response headers readable cross origin", reload: true,
+		def:   "Retry-After,X-RateLimit-Limit,X-RateLimit-Remaining,X-Query-Cost,X-Query-Downsampled,X-Request-ID,ETag,Deprecation,Link",
+		parse: listField(func(c *Config) *[]string { return &c.cors.ExposedHeaders })},
+	{env: "CORS_ALLOW_CREDENTIALS", key: "cors.allow_credentials", def: "true", help: "allow credentials cross origin", reload: true,
+		parse: boolField(func(c *Config) *bool { return &c.cors.AllowCredentials })},
+	{env: "CORS_MAX_AGE", key: "cors.max_age", def: "10m", help: "how long preflight responses may be cached", reload: true,
+		parse: func(c *Config, val string) error {
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				return fmt.Errorf("invalid duration %q", val)
+			}
+			c.cors.MaxAge = int(d.Seconds())
+			return nil
+		}},
+	// Parsed after the other cors settings as routes inherit them
+	{env: "CORS_ROUTE_ORIGINS", key: "cors.routes", help: "per route origins, /prefix=origin,origin;/prefix=origin", reload: true,
+		parse: func(c *Config, val string) error {
+			routes, err := parseCORSRoutes(val, c.cors)
+			c.corsRoutes = routes
+			return err
+		}},
+}
+
+var logLevels = []string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+// validator checks a raw value before it is stored
+type validator func(val string) error
+
+func required(val string) error {
+	if val == "" {
+		return fmt.Errorf("is required")
+	}
+	return nil
+}
+
+func validURL(val string) error {
+	u, err := url.Parse(val)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid URL %q", val)
+	}
+	return nil
+}
+
+func validPort(val string) error {
+	port, err := strconv.Atoi(val)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port %q", val)
+	}
+	return nil
+}
+
+func oneOf(options ...string) validator {
+	return func(val string) error {
+		for _, o := range options {
+			if val == o {
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid value %q, expected one of %s", val, strings.Join(options, ", "))
+	}
+}
+
+func stringField(field func(c *Config) *string, validators ...validator) func(c *Config, val string) error {
+	return func(c *Config, val string) error {
+		for _, v := range validators {
+			if err := v(val); err != nil {
+				return err
+			}
+		}
+		*field(c) = val
+		return nil
+	}
+}
+
+func boolField(field func(c *Config) *bool) func(c *Config, val string) error {
+	return func(c *Config, val string) error {
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", val)
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func durationField(field func(c *Config) *time.Duration) func(c *Config, val string) error {
+	return func(c *Config, val string) error {
+		d, err := time.ParseDuration(val)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid duration %q", val)
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+// floatField parses a float between min and max, a max below min is unbounded
+func floatField(field func(c *Config) *float64, min float64, max float64) func(c *Config, val string) error {
+	return func(c *Config, val string) error {
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil || f < min || (max >= min && f > max) {
+			return fmt.Errorf("invalid number %q", val)
+		}
+		*field(c) = f
+		return nil
+	}
+}
+
+func intField(field func(c *Config) *int, min int) func(c *Config, val string) error {
+	return func(c *Config, val string) error {
+		i, err := strconv.Atoi(val)
+		if err != nil || i < min {
+			return fmt.Errorf("invalid integer %q, minimum %d", val, min)
+		}
+		*field(c) = i
+		return nil
+	}
+}
+
+func int64Field(field func(c *Config) *int64, min int64) func(c *Config, val string) error {
+	return func(c *Config, val string) error {
+		i, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || i < min {
+			return fmt.Errorf("invalid integer %q, minimum %d", val, min)
+		}
+		*field(c) = i
+		return nil
+	}
+}
+
+func listField(field func(c *Config) *[]string) func(c *Config, val string) error {
+	return func(c *Config, val string) error {
+		*field(c) = splitList(val, ",")
+		return nil
+	}
+}
+
+func splitList(val string, sep string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(val, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parseCORSRoutes parses per-route origin overrides in the form
+// "/data=https://a.example,https://*.b.example;/units=*", other options are inherited from base
+func parseCORSRoutes(val string, base CORSOptions) (map[string]CORSOptions, error) {
+	routes := make(map[string]CORSOptions)
+	for _, route := range splitList(val, ";") {
+		parts := strings.SplitN(route, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(strings.TrimSpace(parts[0]), "/") {
+			return routes, fmt.Errorf("invalid route override %q, expected /prefix=origin,origin", route)
+		}
+		opts := base
+		opts.AllowedOrigins = splitList(parts[1], ",")
+		routes[strings.TrimSpace(parts[0])] = opts
+	}
+	return routes, nil
+}
@@ -1,12 +1,25 @@
 package influxdb
 
 import (
+	"context"
+	"time"
+
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	log "github.com/sirupsen/logrus"
 )
 
+// New returns a new InfluxDB client, pinging the server to report whether it is reachable
+// An unreachable server is not fatal, the readiness endpoint will report it until it is
 func New(hostname string, token string) influxdb2.Client {
 	client := influxdb2.NewClient(hostname, token)
-	log.Infof("Successfully connected to InfluxDB at %s", hostname)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if ok, err := client.Ping(ctx); err != nil || !ok {
+		log.Warnf("Cannot reach InfluxDB at %s: %v", hostname, err)
+	} else {
+		log.Infof("Successfully connected to InfluxDB at %s", hostname)
+	}
 	return client
 }
@@ -0,0 +1,199 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"NemWebGoApi/api/models"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultBackfillWorkers is the number of archives backfilled at once
+const DefaultBackfillWorkers = 4
+
+// Backfill loads archives such as AEMO's MMSDM monthly data into Store, several at a time,
+// checkpointing each archive in the backfill_checkpoints table of DB so an interrupted or
+// failed run can be resumed, points already stored are not written again
+type Backfill struct {
+	Store     Store
+	DB        *sql.DB
+	Workers   int
+	BatchSize int
+	Force     bool          // backfill archives already checkpointed as done
+	Progress  time.Duration // how often progress is logged, zero for never
+}
+
+// BackfillError is an archive that failed
+type BackfillError struct {
+	Path  string
+	Error string
+}
+
+// BackfillReport summarises a backfill run
+type BackfillReport struct {
+	Files      int // archives found
+	Skipped    int // archives already done
+	Done       int
+	Failed     int
+	Points     int
+	Duplicates int
+	Invalid    int
+	Elapsed    time.Duration
+	Errors     []BackfillError
+}
+
+// PointsPerSecond is the write throughput of the run
+func (r BackfillReport) PointsPerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Points) / r.Elapsed.Seconds()
+}
+
+type backfillResult struct {
+	checkpoint models.BackfillCheckpoint
+	stats      Stats
+}
+
+// Run backfills the archives at paths, files or directories searched recursively
+// An error is returned only if the run could not proceed, failed archives are in the report
+func (b *Backfill) Run(ctx context.Context, paths ...string) (BackfillReport, error) {
+	// Stops the workers and the feeder however Run returns
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	started := time.Now()
+	report := BackfillReport{Errors: make([]BackfillError, 0)}
+
+	checkpoints, err := models.ReadBackfillCheckpoints(ctx, b.DB)
+	if err != nil {
+		return report, err
+	}
+
+	pending := make([]models.BackfillCheckpoint, 0)
+	for _, path := range paths {
+		files, err := sourceFiles(path)
+		if err != nil {
+			return report, err
+		}
+		for _, file := range files {
+			file, err = filepath.Abs(file)
+			if err != nil {
+				return report, fmt.Errorf("ingest: %w", err)
+			}
+			info, err := os.Stat(file)
+			if err != nil {
+				return report, fmt.Errorf("ingest: %w", err)
+			}
+			report.Files++
+
+			c, ok := checkpoints[file]
+			if ok && !b.Force && c.Status == models.BackfillDone && c.Matches(info.Size(), info.ModTime()) {
+				report.Skipped++
+				continue
+			}
+			pending = append(pending, models.BackfillCheckpoint{Path: file, Size: info.Size(), ModifiedAt: info.ModTime()})
+		}
+	}
+	log.Infof("Backfilling %d of %d archives, %d already done", len(pending), report.Files, report.Skipped)
+
+	workers := b.Workers
+	if workers <= 0 {
+		workers = DefaultBackfillWorkers
+	}
+	jobs := make(chan models.BackfillCheckpoint)
+	results := make(chan backfillResult)
+	for i := 0; i < workers; i++ {
+		go b.work(ctx, jobs, results)
+	}
+	go func() {
+		defer close(jobs)
+		for _, c := range pending {
+			select {
+			case jobs <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var progress <-chan time.Time
+	if b.Progress > 0 {
+		ticker := time.NewTicker(b.Progress)
+		defer ticker.Stop()
+		progress = ticker.C
+	}
+
+	for remaining := len(pending); remaining > 0; {
+		select {
+		case result := <-results:
+			remaining--
+			if err := b.record(ctx, &report, result); err != nil {
+				return report, err
+			}
+		case <-progress:
+			report.Elapsed = time.Since(started)
+			log.Infof("Backfill progress: %d of %d archives, %d failed, %d points, %d duplicates, %.0f points/s",
+				report.Done+report.Failed, len(pending), report.Failed, report.Points, report.Duplicates, report.PointsPerSecond())
+		case <-ctx.Done():
+			report.Elapsed = time.Since(started)
+			return report, fmt.Errorf("ingest: backfill interrupted: %w", ctx.Err())
+		}
+	}
+
+	report.Elapsed = time.Since(started)
+	return report, nil
+}
+
+// work backfills archives from jobs until it is closed, each with its own Ingester so batches are not shared
+func (b *Backfill) work(ctx context.Context, jobs <-chan models.BackfillCheckpoint, results chan<- backfillResult) {
+	for c := range jobs {
+		c.StartedAt = time.Now()
+		ingester := Ingester{Store: b.Store, BatchSize: b.BatchSize, Dedup: true}
+		stats, err := ingester.Ingest(ctx, c.Path)
+		c.FinishedAt = time.Now()
+
+		c.Status = models.BackfillDone
+		if err != nil {
+			c.Status, c.Error = models.BackfillFailed, err.Error()
+		}
+		for _, n := range stats.Points {
+			c.Points += n
+		}
+		c.Duplicates = stats.Duplicates
+
+		select {
+		case results <- backfillResult{checkpoint: c, stats: stats}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// record checkpoints an archive and adds it to the report, archives cut short by cancellation
+// are not checkpointed so they are backfilled again on the next run
+func (b *Backfill) record(ctx context.Context, report *BackfillReport, result backfillResult) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("ingest: backfill interrupted: %w", ctx.Err())
+	}
+
+	c := result.checkpoint
+	report.Points += c.Points
+	report.Duplicates += c.Duplicates
+	report.Invalid += result.stats.Invalid
+	if c.Status == models.BackfillDone {
+		report.Done++
+		log.Infof("Backfilled %s: %d points, %d duplicates in %s", c.Path, c.Points, c.Duplicates, c.FinishedAt.Sub(c.StartedAt).Round(time.Millisecond))
+	} else {
+		report.Failed++
+		report.Errors = append(report.Errors, BackfillError{Path: c.Path, Error: c.Error})
+		log.Warnf("Backfill of %s failed: %s", c.Path, c.Error)
+	}
+
+	return models.SaveBackfillCheckpoint(ctx, b.DB, c)
+}
@@ -0,0 +1,49 @@
+package ingest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"NemWebGoApi/internal/sqlite"
+)
+
+// TestBackfillStopsWorkersOnError checks a run failing to checkpoint an archive returns without
+// leaving the workers or the feeder blocked on the archives still pending
+func TestBackfillStopsWorkersOnError(t *testing.T) {
+	db, err := sqlite.New(filepath.Join(t.TempDir(), "test.sqlite"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TRIGGER fail_checkpoint BEFORE INSERT ON backfill_checkpoints BEGIN
+	SELECT RAISE(ABORT, 'disk full');
+END;`); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	data := readFixture(t, fixtures[0])
+	for _, name := range []string{"a.CSV", "b.CSV", "c.CSV", "d.CSV"} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := runtime.NumGoroutine()
+	backfill := Backfill{Store: &fakeStore{}, DB: db, Workers: 1}
+	if _, err := backfill.Run(context.Background(), dir); err == nil {
+		t.Fatal("Run returned no error for a failed checkpoint")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left running, had %d before Run", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
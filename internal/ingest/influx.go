@@ -0,0 +1,64 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// valueField is the field each point's value is written to, the API reads every field of a measurement
+const valueField = "value"
+
+// InfluxStore writes points to an InfluxDB bucket
+type InfluxStore struct {
+	writer api.WriteAPIBlocking
+	reader api.QueryAPI
+	bucket string
+}
+
+// NewInfluxStore returns a store writing to the bucket of org
+func NewInfluxStore(client influxdb2.Client, org string, bucket string) *InfluxStore {
+	return &InfluxStore{writer: client.WriteAPIBlocking(org, bucket), reader: client.QueryAPI(org), bucket: bucket}
+}
+
+// Write writes the points in a single request
+func (s *InfluxStore) Write(ctx context.Context, points []Point) error {
+	batch := make([]*write.Point, 0, len(points))
+	for _, p := range points {
+		batch = append(batch, write.NewPoint(p.Measurement, p.Tags, map[string]interface{}{valueField: p.Value}, p.Time))
+	}
+	return s.writer.WritePoint(ctx, batch...)
+}
+
+// Existing returns the values of the measurement from start up to stop keyed by pointKey,
+// any field counts so points written by the scraper are found too
+func (s *InfluxStore) Existing(ctx context.Context, measurement string, tag string, start time.Time, stop time.Time) (map[string]float64, error) {
+	fluxQuery := fmt.Sprintf("from(bucket: \"%s\")", s.bucket)
+	fluxQuery += fmt.Sprintf("\n\t|> range(start: %s, stop: %s)", start.UTC().Format(time.RFC3339Nano), stop.UTC().Format(time.RFC3339Nano))
+	fluxQuery += fmt.Sprintf("\n\t|> filter(fn: (r) => r._measurement == \"%s\")", measurement)
+	fluxQuery += fmt.Sprintf("\n\t|> keep(columns: [\"_time\", \"_value\", \"%s\"])", tag)
+
+	result, err := s.reader.Query(ctx, fluxQuery)
+	if err != nil {
+		return nil, fmt.Errorf("ingest.Existing: query error: %w", err)
+	}
+	defer result.Close()
+
+	existing := make(map[string]float64)
+	for result.Next() {
+		record := result.Record()
+		value, ok := record.Value().(float64)
+		if !ok {
+			continue
+		}
+		existing[pointKey(fmt.Sprintf("%v", record.ValueByKey(tag)), record.Time())] = value
+	}
+	if result.Err() != nil {
+		return nil, fmt.Errorf("ingest.Existing: query parsing error: %w", result.Err())
+	}
+	return existing, nil
+}
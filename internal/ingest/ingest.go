@@ -0,0 +1,343 @@
+// Package ingest loads NEMWEB MMS CSV files into the time series store, so data can be
+// reproduced without the scraper, writing the measurements and tags the API reads
+package ingest
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultBatchSize is the number of points written to the store at a time
+const DefaultBatchSize = 5000
+
+// nemTime is the market's time zone, AEST without daylight saving, used for every MMS timestamp
+var nemTime = time.FixedZone("AEST", 10*60*60)
+
+// mmsdmPrefix starts the file names of the MMS Data Model monthly archives
+const mmsdmPrefix = "PUBLIC_DVD_"
+
+// mmsTimeLayout is the layout of MMS timestamps, e.g. 2024/01/31 13:05:00
+const mmsTimeLayout = "2006/01/02 15:04:05"
+
+// Point is a value of a measurement for one tagged series at a time
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Value       float64
+	Time        time.Time
+}
+
+// Store writes points to the time series store
+type Store interface {
+	Write(ctx context.Context, points []Point) error
+}
+
+// Index is implemented by stores that can report the points they hold, so an Ingester with
+// Dedup set can skip writing points already stored with the same value
+type Index interface {
+	Existing(ctx context.Context, measurement string, tag string, start time.Time, stop time.Time) (map[string]float64, error)
+}
+
+// table maps an MMS table onto a measurement, one point per record tagged by tagColumn,
+// intervention pricing runs are left out so each interval has one value
+type table struct {
+	measurement string
+	tag         string
+	tagColumn   string
+	valueColumn string
+}
+
+// tables are the MMS tables ingested, keyed by report type and subtype
+var tables = map[string]table{
+	"DISPATCH_UNIT_SCADA": {measurement: "generation", tag: "unit", tagColumn: "DUID", valueColumn: "SCADAVALUE"},
+	"DISPATCH_REGIONSUM":  {measurement: "demand", tag: "regionId", tagColumn: "REGIONID", valueColumn: "TOTALDEMAND"},
+	"DISPATCH_PRICE":      {measurement: "price", tag: "regionId", tagColumn: "REGIONID", valueColumn: "RRP"},
+}
+
+// Stats counts what an ingest read and wrote
+type Stats struct {
+	Files      int            // CSV files read, including those inside zip archives
+	Points     map[string]int // points written by measurement
+	Skipped    map[string]int // records of tables that are not ingested, by table
+	Invalid    int            // records of ingested tables with a missing or malformed time, tag or value
+	Duplicates int            // points not written as the store already held them
+}
+
+// Ingester reads MMS files and writes their points to Store in batches,
+// with a nil Store points are counted but not written
+// With Dedup set and a Store implementing Index, points the store already holds are not written again
+type Ingester struct {
+	Store     Store
+	BatchSize int
+	Dedup     bool
+
+	batch []Point
+	stats Stats
+}
+
+// Ingest reads each path, a CSV file, a zip archive of CSV files or zip archives as NEMWEB publishes
+// them, or a directory searched recursively for both, and writes the points of the tables it knows
+func (in *Ingester) Ingest(ctx context.Context, paths ...string) (Stats, error) {
+	in.stats = Stats{Points: make(map[string]int), Skipped: make(map[string]int)}
+	if in.BatchSize <= 0 {
+		in.BatchSize = DefaultBatchSize
+	}
+
+	for _, path := range paths {
+		files, err := sourceFiles(path)
+		if err != nil {
+			return in.stats, err
+		}
+		for _, file := range files {
+			if err := in.ingestFile(ctx, file); err != nil {
+				return in.stats, err
+			}
+		}
+	}
+	if err := in.flush(ctx); err != nil {
+		return in.stats, err
+	}
+	return in.stats, nil
+}
+
+// sourceFiles returns path if it is a file, or the CSV and zip files below it in name order
+func sourceFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("ingest: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	files := make([]string, 0)
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && isSource(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ingest: %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// isSource returns true for CSV and zip files, MMSDM archives name the table they hold,
+// e.g. PUBLIC_DVD_DISPATCH_UNIT_SCADA_202301010000.zip, so those of other tables are not read
+func isSource(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext != ".csv" && ext != ".zip" {
+		return false
+	}
+
+	base := strings.ToUpper(filepath.Base(name))
+	if !strings.HasPrefix(base, mmsdmPrefix) {
+		return true
+	}
+	base = strings.ReplaceAll(strings.TrimPrefix(base, mmsdmPrefix), "_", "")
+	for key := range tables {
+		if strings.HasPrefix(base, strings.ReplaceAll(key, "_", "")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (in *Ingester) ingestFile(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("ingest: %w", err)
+	}
+	defer f.Close()
+
+	if strings.ToLower(filepath.Ext(path)) != ".zip" {
+		return in.ingestCSV(ctx, path, f)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("ingest: %w", err)
+	}
+	return in.ingestZip(ctx, path, f, info.Size())
+}
+
+// ingestZip reads the CSV files and nested zip archives of an archive, NEMWEB's archive
+// folders hold a zip per day of zips per interval
+func (in *Ingester) ingestZip(ctx context.Context, name string, r io.ReaderAt, size int64) error {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("ingest: %s: %w", name, err)
+	}
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() || !isSource(f.Name) {
+			continue
+		}
+		entry := name + "/" + f.Name
+
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("ingest: %s: %w", entry, err)
+		}
+		if strings.ToLower(filepath.Ext(f.Name)) == ".zip" {
+			var data []byte
+			if data, err = io.ReadAll(rc); err == nil {
+				err = in.ingestZip(ctx, entry, bytes.NewReader(data), int64(len(data)))
+			} else {
+				err = fmt.Errorf("ingest: %s: %w", entry, err)
+			}
+		} else {
+			err = in.ingestCSV(ctx, entry, rc)
+		}
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in *Ingester) ingestCSV(ctx context.Context, name string, r io.Reader) error {
+	log.Debugln("Ingesting", name)
+	in.stats.Files++
+
+	err := ReadMMS(r, func(record Record) error {
+		t, ok := tables[record.Table]
+		if !ok {
+			in.stats.Skipped[record.Table]++
+			return nil
+		}
+		point, ok := t.point(record)
+		if !ok {
+			in.stats.Invalid++
+			return nil
+		}
+		if point == nil {
+			return nil
+		}
+
+		in.batch = append(in.batch, *point)
+		if len(in.batch) >= in.BatchSize {
+			return in.flush(ctx)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ingest: %s: %w", name, err)
+	}
+	return nil
+}
+
+// point converts a record, returning false if it is malformed and nil for intervention runs
+func (t table) point(record Record) (*Point, bool) {
+	if intervention := record.Get("INTERVENTION"); intervention != "" && intervention != "0" {
+		return nil, true
+	}
+
+	at, err := time.ParseInLocation(mmsTimeLayout, record.Get("SETTLEMENTDATE"), nemTime)
+	if err != nil {
+		return nil, false
+	}
+	tag := record.Get(t.tagColumn)
+	if tag == "" {
+		return nil, false
+	}
+	value, err := strconv.ParseFloat(record.Get(t.valueColumn), 64)
+	if err != nil {
+		return nil, false
+	}
+
+	return &Point{
+		Measurement: t.measurement,
+		Tags:        map[string]string{t.tag: tag},
+		Value:       value,
+		Time:        at,
+	}, true
+}
+
+func (in *Ingester) flush(ctx context.Context) error {
+	if len(in.batch) == 0 {
+		return nil
+	}
+	if index, ok := in.Store.(Index); ok && in.Dedup {
+		if err := in.dropExisting(ctx, index); err != nil {
+			return err
+		}
+	}
+	if in.Store != nil && len(in.batch) > 0 {
+		if err := in.Store.Write(ctx, in.batch); err != nil {
+			return fmt.Errorf("ingest: write error: %w", err)
+		}
+	}
+	for _, point := range in.batch {
+		in.stats.Points[point.Measurement]++
+	}
+	in.batch = in.batch[:0]
+	return nil
+}
+
+// dropExisting removes the points of the batch the store already holds with the same value,
+// revised values are kept so they overwrite the stored ones
+func (in *Ingester) dropExisting(ctx context.Context, index Index) error {
+	type span struct {
+		tag         string
+		start, stop time.Time
+	}
+	spans := make(map[string]*span)
+	for _, p := range in.batch {
+		s, ok := spans[p.Measurement]
+		if !ok {
+			s = &span{start: p.Time, stop: p.Time}
+			for tag := range p.Tags {
+				s.tag = tag
+			}
+			spans[p.Measurement] = s
+		}
+		if p.Time.Before(s.start) {
+			s.start = p.Time
+		}
+		if p.Time.After(s.stop) {
+			s.stop = p.Time
+		}
+	}
+
+	existing := make(map[string]map[string]float64)
+	for measurement, s := range spans {
+		values, err := index.Existing(ctx, measurement, s.tag, s.start, s.stop.Add(time.Nanosecond))
+		if err != nil {
+			return fmt.Errorf("ingest: dedup error: %w", err)
+		}
+		existing[measurement] = values
+	}
+
+	kept := in.batch[:0]
+	for _, p := range in.batch {
+		tag := spans[p.Measurement].tag
+		if value, ok := existing[p.Measurement][pointKey(p.Tags[tag], p.Time)]; ok && value == p.Value {
+			in.stats.Duplicates++
+			continue
+		}
+		kept = append(kept, p)
+	}
+	in.batch = kept
+	return nil
+}
+
+// pointKey identifies a point of a measurement by its tag value and time
+func pointKey(tag string, t time.Time) string {
+	return tag + "@" + strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,241 @@
+package ingest
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixtures are the MMS files in testdata, a SCADA file and a dispatch file with the
+// CASE_SOLUTION, PRICE and REGIONSUM tables
+var fixtures = []string{
+	"PUBLIC_DISPATCHSCADA_202401311305_0000000409000001.CSV",
+	"PUBLIC_DISPATCHIS_202401311305_0000000409000002.CSV",
+}
+
+// interval is the settlement time of every fixture record, 13:05 market time
+var interval = time.Date(2024, 1, 31, 3, 5, 0, 0, time.UTC)
+
+// fixturePoints are the valid points of the fixtures in file order
+var fixturePoints = []Point{
+	{Measurement: "generation", Tags: map[string]string{"unit": "BAYSW1"}, Value: 652.4, Time: interval},
+	{Measurement: "generation", Tags: map[string]string{"unit": "ER01"}, Value: 0, Time: interval},
+	{Measurement: "generation", Tags: map[string]string{"unit": "HDWF1"}, Value: -0.25, Time: interval},
+	{Measurement: "price", Tags: map[string]string{"regionId": "NSW1"}, Value: 85.12, Time: interval},
+	{Measurement: "price", Tags: map[string]string{"regionId": "QLD1"}, Value: -12.5, Time: interval},
+	{Measurement: "demand", Tags: map[string]string{"regionId": "NSW1"}, Value: 8123.45, Time: interval},
+	{Measurement: "demand", Tags: map[string]string{"regionId": "QLD1"}, Value: 6543.21, Time: interval},
+}
+
+// fakeStore records the points written to it
+type fakeStore struct {
+	points  []Point
+	batches int
+}
+
+func (s *fakeStore) Write(ctx context.Context, points []Point) error {
+	s.points = append(s.points, points...)
+	s.batches++
+	return nil
+}
+
+// fakeIndex is a store already holding points, keyed by measurement then pointKey
+type fakeIndex struct {
+	fakeStore
+	held    map[string]map[string]float64
+	queries []string
+}
+
+func (s *fakeIndex) Existing(ctx context.Context, measurement string, tag string, start time.Time, stop time.Time) (map[string]float64, error) {
+	s.queries = append(s.queries, measurement+"/"+tag)
+	existing := make(map[string]float64)
+	for key, value := range s.held[measurement] {
+		existing[key] = value
+	}
+	return existing, nil
+}
+
+// archiveFile is a file to add to a zip archive
+type archiveFile struct {
+	name string
+	data []byte
+}
+
+// zipFiles returns a zip archive holding the files in order
+func zipFiles(t *testing.T, files ...archiveFile) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(file.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// fixtureArchive writes the fixtures to a zip archive in a temporary directory, nested as
+// NEMWEB's archive folders publish them, a zip of the day holding a zip per file
+func fixtureArchive(t *testing.T) string {
+	t.Helper()
+
+	day := make([]archiveFile, 0, len(fixtures))
+	for _, name := range fixtures {
+		zipName := strings.TrimSuffix(name, filepath.Ext(name)) + ".zip"
+		day = append(day, archiveFile{zipName, zipFiles(t, archiveFile{name, readFixture(t, name)})})
+	}
+	path := filepath.Join(t.TempDir(), "PUBLIC_DISPATCHIS_20240131.zip")
+	if err := os.WriteFile(path, zipFiles(t, day...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestIngestFixtures(t *testing.T) {
+	paths := map[string]func(t *testing.T) []string{
+		"csv": func(t *testing.T) []string {
+			files := make([]string, 0, len(fixtures))
+			for _, name := range fixtures {
+				files = append(files, filepath.Join("testdata", name))
+			}
+			return files
+		},
+		"zip": func(t *testing.T) []string {
+			return []string{fixtureArchive(t)}
+		},
+	}
+
+	for name, fixturePaths := range paths {
+		t.Run(name, func(t *testing.T) {
+			store := &fakeStore{}
+			in := Ingester{Store: store}
+			stats, err := in.Ingest(context.Background(), fixturePaths(t)...)
+			if err != nil {
+				t.Fatalf("Ingest: %v", err)
+			}
+
+			want := Stats{
+				Files:   2,
+				Points:  map[string]int{"generation": 3, "price": 2, "demand": 2},
+				Skipped: map[string]int{"DISPATCH_CASE_SOLUTION": 1},
+				// LOYYB1 has no value, a SCADA record has no DUID, an SA1 price has a malformed
+				// time and the VIC1 demand record is cut short, the QLD1 intervention price is left out
+				Invalid: 4,
+			}
+			if !reflect.DeepEqual(stats, want) {
+				t.Errorf("stats = %+v, want %+v", stats, want)
+			}
+			if !pointsEqual(store.points, fixturePoints) {
+				t.Errorf("wrote %+v, want %+v", store.points, fixturePoints)
+			}
+		})
+	}
+}
+
+func TestIngestBatches(t *testing.T) {
+	store := &fakeStore{}
+	in := Ingester{Store: store, BatchSize: 3}
+	if _, err := in.Ingest(context.Background(), filepath.Join("testdata", fixtures[1])); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+
+	// 4 points in batches of 3, the last flushed at the end of the ingest
+	if store.batches != 2 {
+		t.Errorf("wrote %d batches, want 2", store.batches)
+	}
+	if !pointsEqual(store.points, fixturePoints[3:]) {
+		t.Errorf("wrote %+v, want %+v", store.points, fixturePoints[3:])
+	}
+}
+
+func TestIngestDedup(t *testing.T) {
+	held := map[string]map[string]float64{
+		"generation": {
+			pointKey("BAYSW1", interval): 652.4, // unchanged
+			pointKey("ER01", interval):   10,    // revised since it was stored
+		},
+		"demand": {
+			pointKey("NSW1", interval):                      8123.45, // unchanged
+			pointKey("QLD1", interval.Add(-5*time.Minute)):  6500,    // another interval
+			pointKey("VIC1", interval):                      5000,    // not in the fixtures
+			pointKey("BAYSW1", interval.Add(5*time.Minute)): 1,       // another measurement's tag
+		},
+	}
+	paths := []string{filepath.Join("testdata", fixtures[0]), filepath.Join("testdata", fixtures[1])}
+
+	t.Run("enabled", func(t *testing.T) {
+		store := &fakeIndex{held: held}
+		in := Ingester{Store: store, Dedup: true}
+		stats, err := in.Ingest(context.Background(), paths...)
+		if err != nil {
+			t.Fatalf("Ingest: %v", err)
+		}
+
+		if stats.Duplicates != 2 {
+			t.Errorf("duplicates = %d, want 2", stats.Duplicates)
+		}
+		want := []Point{fixturePoints[1], fixturePoints[2], fixturePoints[3], fixturePoints[4], fixturePoints[6]}
+		if !pointsEqual(store.points, want) {
+			t.Errorf("wrote %+v, want %+v", store.points, want)
+		}
+		if wantPoints := map[string]int{"generation": 2, "price": 2, "demand": 1}; !reflect.DeepEqual(stats.Points, wantPoints) {
+			t.Errorf("points = %v, want %v", stats.Points, wantPoints)
+		}
+		if len(store.queries) != 3 {
+			t.Errorf("queried %v, want one query per measurement", store.queries)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		store := &fakeIndex{held: held}
+		in := Ingester{Store: store}
+		stats, err := in.Ingest(context.Background(), paths...)
+		if err != nil {
+			t.Fatalf("Ingest: %v", err)
+		}
+
+		if stats.Duplicates != 0 || len(store.queries) != 0 {
+			t.Errorf("duplicates = %d after %d queries, want no dedup", stats.Duplicates, len(store.queries))
+		}
+		if !pointsEqual(store.points, fixturePoints) {
+			t.Errorf("wrote %+v, want %+v", store.points, fixturePoints)
+		}
+	})
+}
+
+func pointsEqual(got []Point, want []Point) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i].Measurement != want[i].Measurement || got[i].Value != want[i].Value ||
+			!got[i].Time.Equal(want[i].Time) || !reflect.DeepEqual(got[i].Tags, want[i].Tags) {
+			return false
+		}
+	}
+	return true
+}
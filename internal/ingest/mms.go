@@ -0,0 +1,69 @@
+package ingest
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Record is a data row of an MMS table, values keyed by upper case column name
+type Record struct {
+	Table  string
+	Line   int
+	values map[string]string
+}
+
+// Get returns the value of the column, empty if the table has no such column
+func (r Record) Get(column string) string {
+	return r.values[column]
+}
+
+// ReadMMS reads an MMS format CSV, calling fn with each D record of the tables it contains
+// MMS files interleave C (comment), I (column header) and D (data) records, a D record belongs to the
+// table of the last I record, tables are named by report type and subtype, e.g. DISPATCH_UNIT_SCADA
+func ReadMMS(r io.Reader, fn func(Record) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	table := ""
+	var columns []string
+	for line := 1; ; line++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("ingest.ReadMMS: %w", err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.TrimSpace(fields[0]) {
+		case "I":
+			if len(fields) < 5 {
+				return fmt.Errorf("ingest.ReadMMS: line %d: short I record", line)
+			}
+			table = strings.ToUpper(strings.TrimSpace(fields[1]) + "_" + strings.TrimSpace(fields[2]))
+			columns = make([]string, 0, len(fields)-4)
+			for _, column := range fields[4:] {
+				columns = append(columns, strings.ToUpper(strings.TrimSpace(column)))
+			}
+		case "D":
+			if columns == nil {
+				return fmt.Errorf("ingest.ReadMMS: line %d: D record before any I record", line)
+			}
+			record := Record{Table: table, Line: line, values: make(map[string]string, len(columns))}
+			for i, column := range columns {
+				if i+4 < len(fields) {
+					record.values[column] = strings.TrimSpace(fields[i+4])
+				}
+			}
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, data string) ([]Record, error) {
+	t.Helper()
+
+	records := make([]Record, 0)
+	err := ReadMMS(strings.NewReader(data), func(record Record) error {
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+func TestReadMMS(t *testing.T) {
+	data := strings.Join([]string{
+		`C,NEMP.WORLD,DISPATCHIS,AEMO,PUBLIC,2024/01/31`,
+		`I,DISPATCH,price,5,SETTLEMENTDATE,regionid, RRP `,
+		`D,DISPATCH,PRICE,5,"2024/01/31 13:05:00",NSW1, 85.12 `,
+		`C,a comment between data records`,
+		`D,DISPATCH,PRICE,5,"2024/01/31 13:05:00",QLD1`,
+		`I,DISPATCH,REGIONSUM,8,SETTLEMENTDATE,REGIONID,TOTALDEMAND`,
+		`D,DISPATCH,REGIONSUM,8,"2024/01/31 13:05:00",VIC1,"5,000"`,
+		`C,"END OF REPORT",9`,
+	}, "\n")
+
+	records, err := readAll(t, data)
+	if err != nil {
+		t.Fatalf("ReadMMS: %v", err)
+	}
+
+	want := []struct {
+		table  string
+		line   int
+		values map[string]string
+	}{
+		{"DISPATCH_PRICE", 3, map[string]string{"SETTLEMENTDATE": "2024/01/31 13:05:00", "REGIONID": "NSW1", "RRP": "85.12"}},
+		{"DISPATCH_PRICE", 5, map[string]string{"SETTLEMENTDATE": "2024/01/31 13:05:00", "REGIONID": "QLD1", "RRP": ""}},
+		{"DISPATCH_REGIONSUM", 7, map[string]string{"SETTLEMENTDATE": "2024/01/31 13:05:00", "REGIONID": "VIC1", "TOTALDEMAND": "5,000"}},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d", len(records), len(want))
+	}
+	for i, w := range want {
+		record := records[i]
+		if record.Table != w.table {
+			t.Errorf("record %d: table = %q, want %q", i, record.Table, w.table)
+		}
+		if record.Line != w.line {
+			t.Errorf("record %d: line = %d, want %d", i, record.Line, w.line)
+		}
+		for column, value := range w.values {
+			if got := record.Get(column); got != value {
+				t.Errorf("record %d: %s = %q, want %q", i, column, got, value)
+			}
+		}
+		if got := record.Get("MISSING"); got != "" {
+			t.Errorf("record %d: unknown column = %q, want empty", i, got)
+		}
+	}
+}
+
+func TestReadMMSErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"D record before any I record", "C,header\nD,DISPATCH,PRICE,5,x"},
+		{"short I record", "I,DISPATCH,PRICE,5"},
+		{"malformed CSV", "I,DISPATCH,PRICE,5,RRP\nD,DISPATCH,PRICE,5,\"1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readAll(t, tt.data); err == nil {
+				t.Fatal("ReadMMS returned no error")
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package metrics
+
+// Metrics exposed by the API on /metrics
+
+var (
+	// HTTPRequests counts requests by route template, method and response status
+	HTTPRequests = NewCounterVec(
+		"nemweb_api_http_requests_total",
+		"Total HTTP requests by route template, method and status.",
+		"route", "method", "status",
+	)
+
+	// HTTPRequestDuration observes request latency by route template, method and response status
+	HTTPRequestDuration = NewHistogramVec(
+		"nemweb_api_http_request_duration_seconds",
+		"HTTP request latency in seconds by route template, method and status.",
+		DefaultBuckets,
+		"route", "method", "status",
+	)
+
+	// UpstreamQueryDuration observes InfluxDB and SQLite query latency
+	UpstreamQueryDuration = NewHistogramVec(
+		"nemweb_api_upstream_query_duration_seconds",
+		"Upstream query latency in seconds by store and measurement.",
+		DefaultBuckets,
+		"store", "measurement",
+	)
+
+	// UpstreamQueryErrors counts failed InfluxDB and SQLite queries
+	UpstreamQueryErrors = NewCounterVec(
+		"nemweb_api_upstream_query_errors_total",
+		"Failed upstream queries by store and measurement.",
+		"store", "measurement",
+	)
+
+	// UpstreamRowsReturned counts rows read from InfluxDB and SQLite
+	UpstreamRowsReturned = NewCounterVec(
+		"nemweb_api_upstream_rows_returned_total",
+		"Rows returned by upstream queries by store and measurement.",
+		"store", "measurement",
+	)
+
+	// CacheRequests counts cache lookups by cache name and result (hit or miss)
+	CacheRequests = NewCounterVec(
+		"nemweb_api_cache_requests_total",
+		"Cache lookups by cache and result.",
+		"cache", "result",
+	)
+
+	// CacheHitRatio is the hits / lookups ratio for each cache since start, computed on scrape
+	CacheHitRatio = NewGaugeVec(
+		"nemweb_api_cache_hit_ratio",
+		"Ratio of cache hits to lookups since start.",
+		"cache",
+	)
+
+	// DataAge is the age in seconds of the latest demand point per region, computed on scrape
+	DataAge = NewGaugeVec(
+		"nemweb_api_data_age_seconds",
+		"Age in seconds of the latest demand data point by region.",
+		"region",
+	)
+
+	// ConfigReloads counts configuration reloads by result (success or failure)
+	ConfigReloads = NewCounterVec(
+		"nemweb_api_config_reloads_total",
+		"Configuration reloads by result.",
+		"result",
+	)
+)
+
+// Store names used as the "store" label
+const (
+	StoreInflux = "influxdb"
+	StoreSQLite = "sqlite"
+)
+
+// Cache results used as the "result" label
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+// ObserveCache records a cache lookup and updates the hit ratio
+func ObserveCache(cache string, hit bool) {
+	if hit {
+		CacheRequests.Inc(cache, CacheHit)
+	} else {
+		CacheRequests.Inc(cache, CacheMiss)
+	}
+
+	hits := CacheRequests.Value(cache, CacheHit)
+	misses := CacheRequests.Value(cache, CacheMiss)
+	CacheHitRatio.Set(hits/(hits+misses), cache)
+}
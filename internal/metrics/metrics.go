@@ -0,0 +1,313 @@
+// Package metrics is a minimal Prometheus text exposition implementation,
+// supporting labelled counters, gauges and histograms without the client_golang dependency
+// See: https://prometheus.io/docs/instrumenting/exposition_formats/
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram buckets in seconds used for latency metrics
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// collector is a metric family that can write itself in the text format
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds the metric families exposed by a handler
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	hooks      []func()
+}
+
+// DefaultRegistry is the registry used by the package level constructors and Handler
+var DefaultRegistry = &Registry{}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// OnScrape registers a function run before each scrape,
+// used to refresh gauges that are expensive to keep up to date continuously
+func (r *Registry) OnScrape(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, fn)
+}
+
+// Write writes every registered metric family in the Prometheus text format
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	hooks := append([]func(){}, r.hooks...)
+	collectors := append([]collector{}, r.collectors...)
+	r.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler returns an http.Handler serving the registry
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// OnScrape registers a scrape hook on the DefaultRegistry
+func OnScrape(fn func()) {
+	DefaultRegistry.OnScrape(fn)
+}
+
+// Handler serves the DefaultRegistry
+func Handler() http.Handler {
+	return DefaultRegistry.Handler()
+}
+
+// family holds the state shared by every metric type
+type family struct {
+	metricName string
+	help       string
+	labelNames []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// histogram only
+	buckets []uint64
+	count   uint64
+}
+
+func newFamily(name, help string, labelNames []string) family {
+	return family{
+		metricName: name,
+		help:       help,
+		labelNames: labelNames,
+		series:     make(map[string]*series),
+	}
+}
+
+func (f *family) name() string {
+	return f.metricName
+}
+
+// get returns the series for the label values, creating it if needed, must hold f.mu
+func (f *family) get(labelValues []string, buckets int) *series {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d labels, got %d", f.metricName, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{
+			labelValues: append([]string{}, labelValues...),
+			buckets:     make([]uint64, buckets),
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series ordered by label values so output is stable, must hold f.mu
+func (f *family) sorted() []*series {
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]*series, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, f.series[k])
+	}
+	return out
+}
+
+func (f *family) writeHeader(w io.Writer, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.metricName, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.metricName, metricType)
+}
+
+// labels formats label pairs, extra is appended as-is (used for histogram "le")
+func (f *family) labels(values []string, extra string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, name := range f.labelNames {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escapeLabel(values[i])))
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// CounterVec is a monotonically increasing value partitioned by labels
+type CounterVec struct {
+	family
+}
+
+// NewCounterVec creates and registers a counter on the DefaultRegistry
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{newFamily(name, help, labelNames)}
+	DefaultRegistry.register(c)
+	return c
+}
+
+// Add increases the counter for the label values by v
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(labelValues, 0).value += v
+}
+
+// Inc increases the counter for the label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the current value for the label values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(labelValues, 0).value
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeHeader(w, "counter")
+	for _, s := range c.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, c.labels(s.labelValues, ""), formatFloat(s.value))
+	}
+}
+
+// GaugeVec is a value that can go up and down partitioned by labels
+type GaugeVec struct {
+	family
+}
+
+// NewGaugeVec creates and registers a gauge on the DefaultRegistry
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{newFamily(name, help, labelNames)}
+	DefaultRegistry.register(g)
+	return g
+}
+
+// Set sets the gauge for the label values
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.get(labelValues, 0).value = v
+}
+
+// Reset removes every series, used when the set of label values is recomputed on scrape
+func (g *GaugeVec) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.series = make(map[string]*series)
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.writeHeader(w, "gauge")
+	for _, s := range g.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", g.metricName, g.labels(s.labelValues, ""), formatFloat(s.value))
+	}
+}
+
+// HistogramVec counts observations into cumulative buckets partitioned by labels
+type HistogramVec struct {
+	family
+	upperBounds []float64
+}
+
+// NewHistogramVec creates and registers a histogram on the DefaultRegistry,
+// buckets must be sorted ascending and should not include +Inf
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{
+		family:      newFamily(name, help, labelNames),
+		upperBounds: buckets,
+	}
+	DefaultRegistry.register(h)
+	return h
+}
+
+// Observe records v for the label values
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(labelValues, len(h.upperBounds))
+	for i, upper := range h.upperBounds {
+		if v <= upper {
+			s.buckets[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w, "histogram")
+	for _, s := range h.sorted() {
+		for i, upper := range h.upperBounds {
+			le := fmt.Sprintf("le=\"%s\"", formatFloat(upper))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labels(s.labelValues, le), s.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labels(s.labelValues, "le=\"+Inf\""), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, h.labels(s.labelValues, ""), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, h.labels(s.labelValues, ""), s.count)
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+var helpEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
@@ -0,0 +1,92 @@
+// Package ratelimit implements per-client token bucket rate limiting
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepThreshold is the number of buckets above which idle buckets are removed
+const sweepThreshold = 4096
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter hands out tokens per client key, refilling at rate tokens per second up to burst
+// A rate of zero or less disables limiting
+type Limiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+}
+
+// New returns a limiter allowing rate requests per second with bursts of up to burst requests
+func New(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// SetLimits changes the rate and burst, existing buckets keep their tokens capped to the new burst
+func (l *Limiter) SetLimits(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rate
+	l.burst = float64(burst)
+	for _, b := range l.buckets {
+		b.tokens = math.Min(b.tokens, l.burst)
+	}
+}
+
+// Limit returns the burst size, used for the X-RateLimit-Limit header
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.burst)
+}
+
+// Allow takes a token for key, returning whether the request may proceed,
+// the tokens remaining and how long to wait for the next token if not
+func (l *Limiter) Allow(key string) (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate <= 0 {
+		return true, int(l.burst), 0
+	}
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= sweepThreshold {
+			l.sweep(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, 0, wait
+	}
+	b.tokens--
+	return true, int(b.tokens), 0
+}
+
+// sweep removes buckets that have refilled completely, they are equivalent to new buckets
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationFile matches migration file names, e.g. 0001_create_units.up.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migrationRequires matches the first line of an up file naming the SQLite compile option it needs,
+// e.g. -- requires: ENABLE_FTS5
+var migrationRequires = regexp.MustCompile(`^--\s*requires:\s*(\w+)`)
+
+// Migration is a versioned schema change with the SQL to apply and revert it
+type Migration struct {
+	Version   int
+	Name      string
+	Up        string
+	Down      string
+	Requires  string     // SQLite compile option needed, the migration stays pending in builds without it
+	AppliedAt *time.Time // nil if not applied, set by Status
+}
+
+// Migrations returns the embedded migrations in version order
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("sqlite.Migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("sqlite.Migrations: invalid migration file name %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("sqlite.Migrations: %w", err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("sqlite.Migrations: version %d has names %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+			if requires := migrationRequires.FindStringSubmatch(m.Up); requires != nil {
+				m.Requires = requires[1]
+			}
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("sqlite.Migrations: version %d needs both up and down files", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// LatestVersion returns the version of the newest embedded migration
+func LatestVersion() (int, error) {
+	migrations, err := Migrations()
+	if err != nil || len(migrations) == 0 {
+		return 0, err
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// Status returns every embedded migration with AppliedAt set for those recorded in schema_migrations
+func Status(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	for i := range migrations {
+		if t, ok := applied[migrations[i].Version]; ok {
+			migrations[i].AppliedAt = &t
+		}
+	}
+	return migrations, nil
+}
+
+// Migrate applies every pending migration, returning those applied
+func Migrate(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	latest, err := LatestVersion()
+	if err != nil {
+		return nil, err
+	}
+	return MigrateTo(ctx, db, latest)
+}
+
+// MigrateTo applies pending migrations up to and including target, or reverts applied
+// migrations above target newest first, returning the migrations run
+// Each migration runs in its own transaction with its schema_migrations record, migrations
+// requiring a compile option this SQLite build lacks are left pending
+func MigrateTo(ctx context.Context, db *sql.DB, target int) ([]Migration, error) {
+	migrations, err := Status(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	run := make([]Migration, 0)
+	for _, m := range migrations {
+		if m.AppliedAt == nil && m.Version <= target {
+			if m.Requires != "" {
+				ok, err := CompileOption(ctx, db, m.Requires)
+				if err != nil {
+					return run, err
+				}
+				if !ok {
+					continue
+				}
+			}
+			if err := apply(ctx, db, m, true); err != nil {
+				return run, err
+			}
+			run = append(run, m)
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.AppliedAt != nil && m.Version > target {
+			if err := apply(ctx, db, m, false); err != nil {
+				return run, err
+			}
+			run = append(run, m)
+		}
+	}
+	return run, nil
+}
+
+func apply(ctx context.Context, db *sql.DB, m Migration, up bool) error {
+	direction, stmt := "up", m.Up
+	if !up {
+		direction, stmt = "down", m.Down
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("sqlite.MigrateTo: begin error: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("sqlite.MigrateTo: %04d_%s %s error: %w", m.Version, m.Name, direction, err)
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, time.Now().UTC())
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("sqlite.MigrateTo: recording %04d_%s error: %w", m.Version, m.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite.MigrateTo: commit error: %w", err)
+	}
+	return nil
+}
+
+// CompileOption reports whether SQLite was built with the option, e.g. ENABLE_FTS5
+func CompileOption(ctx context.Context, db *sql.DB, option string) (bool, error) {
+	var used bool
+	if err := db.QueryRowContext(ctx, "SELECT sqlite_compileoption_used(?)", option).Scan(&used); err != nil {
+		return false, fmt.Errorf("sqlite.CompileOption: %w", err)
+	}
+	return used, nil
+}
+
+// appliedVersions returns when each recorded migration was applied, creating schema_migrations if needed
+func appliedVersions(ctx context.Context, db *sql.DB) (map[int]time.Time, error) {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite.Status: create schema_migrations error: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("sqlite.Status: query error: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("sqlite.Status: scan error: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite.Status: query parsing error: %w", err)
+	}
+	return applied, nil
+}
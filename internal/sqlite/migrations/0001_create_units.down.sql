@@ -0,0 +1,2 @@
+-- The units table may have been created and filled by the scraper before migrations were used,
+-- so reverting this migration keeps it rather than deleting data this API did not create
@@ -0,0 +1,9 @@
+-- Generating units, historically created by the scraper so existing tables are kept
+CREATE TABLE IF NOT EXISTS units (
+	duid TEXT NOT NULL PRIMARY KEY,
+	station_name TEXT NOT NULL DEFAULT '',
+	region_id TEXT NOT NULL DEFAULT '',
+	fuel_source TEXT NOT NULL DEFAULT '',
+	technology_type TEXT NOT NULL DEFAULT '',
+	max_capacity INTEGER NOT NULL DEFAULT 0
+);
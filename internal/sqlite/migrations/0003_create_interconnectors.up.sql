@@ -0,0 +1,9 @@
+-- Interconnectors between NEM regions, flow is positive from from_region to to_region
+CREATE TABLE IF NOT EXISTS interconnectors (
+	interconnector_id TEXT NOT NULL PRIMARY KEY,
+	from_region_id TEXT NOT NULL,
+	to_region_id TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	max_import INTEGER NOT NULL DEFAULT 0,
+	max_export INTEGER NOT NULL DEFAULT 0
+);
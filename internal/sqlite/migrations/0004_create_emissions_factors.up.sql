@@ -0,0 +1,8 @@
+-- Emissions intensity per unit in tonnes CO2-e per MWh sent out, effective from a date
+CREATE TABLE IF NOT EXISTS emissions_factors (
+	duid TEXT NOT NULL,
+	effective_from TIMESTAMP NOT NULL,
+	co2e_intensity REAL NOT NULL,
+	source TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (duid, effective_from)
+);
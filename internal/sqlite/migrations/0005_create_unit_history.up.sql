@@ -0,0 +1,12 @@
+-- Audit history of changes made to units through the API, before and after are JSON, null for create and delete
+CREATE TABLE IF NOT EXISTS unit_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	duid TEXT NOT NULL,
+	action TEXT NOT NULL,
+	changed_by TEXT NOT NULL,
+	changed_at TIMESTAMP NOT NULL,
+	before TEXT,
+	after TEXT
+);
+
+CREATE INDEX IF NOT EXISTS unit_history_duid ON unit_history (duid, changed_at);
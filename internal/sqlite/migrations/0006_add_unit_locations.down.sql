@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS units_location;
+ALTER TABLE units DROP COLUMN state;
+ALTER TABLE units DROP COLUMN longitude;
+ALTER TABLE units DROP COLUMN latitude;
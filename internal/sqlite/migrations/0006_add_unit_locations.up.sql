@@ -0,0 +1,6 @@
+-- Optional unit locations for maps and spatial filters, loaded with "units import-locations"
+ALTER TABLE units ADD COLUMN latitude REAL;
+ALTER TABLE units ADD COLUMN longitude REAL;
+ALTER TABLE units ADD COLUMN state TEXT;
+
+CREATE INDEX IF NOT EXISTS units_location ON units (latitude, longitude);
@@ -0,0 +1,12 @@
+-- Progress of "backfill" per archive, a file is skipped on later runs once done unless its size or mtime change
+CREATE TABLE IF NOT EXISTS backfill_checkpoints (
+	path TEXT PRIMARY KEY,
+	size INTEGER NOT NULL,
+	modified_at TIMESTAMP NOT NULL,
+	status TEXT NOT NULL,
+	points INTEGER NOT NULL DEFAULT 0,
+	duplicates INTEGER NOT NULL DEFAULT 0,
+	error TEXT,
+	started_at TIMESTAMP NOT NULL,
+	finished_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,29 @@
+-- requires: ENABLE_FTS5
+-- FTS5 index over the searchable units columns for /search, kept in step with units by triggers,
+-- including writes made outside the API. The prefix indexes make the short prefix queries sent while typing cheap
+CREATE VIRTUAL TABLE IF NOT EXISTS units_search USING fts5(
+	duid, station_name, fuel_source, technology_type,
+	content = 'units', content_rowid = 'rowid',
+	tokenize = 'unicode61 remove_diacritics 2',
+	prefix = '2 3'
+);
+
+CREATE TRIGGER IF NOT EXISTS units_search_insert AFTER INSERT ON units BEGIN
+	INSERT INTO units_search (rowid, duid, station_name, fuel_source, technology_type)
+	VALUES (new.rowid, new.duid, new.station_name, new.fuel_source, new.technology_type);
+END;
+
+CREATE TRIGGER IF NOT EXISTS units_search_delete AFTER DELETE ON units BEGIN
+	INSERT INTO units_search (units_search, rowid, duid, station_name, fuel_source, technology_type)
+	VALUES ('delete', old.rowid, old.duid, old.station_name, old.fuel_source, old.technology_type);
+END;
+
+CREATE TRIGGER IF NOT EXISTS units_search_update AFTER UPDATE ON units BEGIN
+	INSERT INTO units_search (units_search, rowid, duid, station_name, fuel_source, technology_type)
+	VALUES ('delete', old.rowid, old.duid, old.station_name, old.fuel_source, old.technology_type);
+	INSERT INTO units_search (rowid, duid, station_name, fuel_source, technology_type)
+	VALUES (new.rowid, new.duid, new.station_name, new.fuel_source, new.technology_type);
+END;
+
+-- Indexes the units already in the table
+INSERT INTO units_search (units_search) VALUES ('rebuild');
@@ -0,0 +1,58 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// searchMigration creates the units_search FTS5 index and the triggers keeping it in sync
+const searchMigration = 8
+
+// searchTriggers are the triggers created by searchMigration
+var searchTriggers = []string{"units_search_insert", "units_search_delete", "units_search_update"}
+
+// SearchIndexReady returns true if the units_search FTS5 index can be queried, false if SQLite
+// was built without FTS5, build with -tags sqlite_fts5 to include it, or its migration is pending
+// Without FTS5 the sync triggers of a database migrated by another build are dropped so writes to
+// units keep working, and the migration is marked pending so it rebuilds the index once FTS5 is back
+func SearchIndexReady(ctx context.Context, db *sql.DB) (bool, error) {
+	fts5, err := CompileOption(ctx, db, "ENABLE_FTS5")
+	if err != nil {
+		return false, fmt.Errorf("sqlite.SearchIndexReady: %w", err)
+	}
+
+	migrations, err := Status(ctx, db)
+	if err != nil {
+		return false, fmt.Errorf("sqlite.SearchIndexReady: %w", err)
+	}
+	applied := false
+	for _, m := range migrations {
+		if m.Version == searchMigration {
+			applied = m.AppliedAt != nil
+		}
+	}
+	if fts5 || !applied {
+		return fts5 && applied, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("sqlite.SearchIndexReady: begin error: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, name := range searchTriggers {
+		if _, err := tx.ExecContext(ctx, "DROP TRIGGER IF EXISTS "+name); err != nil {
+			return false, fmt.Errorf("sqlite.SearchIndexReady: drop %s error: %w", name, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", searchMigration); err != nil {
+		return false, fmt.Errorf("sqlite.SearchIndexReady: unrecord migration error: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("sqlite.SearchIndexReady: commit error: %w", err)
+	}
+	return false, nil
+}
@@ -1,20 +1,44 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"os"
 
 	_ "github.com/mattn/go-sqlite3" // Required for SQLite
 	log "github.com/sirupsen/logrus"
 )
 
 // New, returns a new instance of sql db
-func New(filepath string) *sql.DB {
+// If migrate is set pending schema migrations are applied, creating the file if needed,
+// an error is returned if one fails so the schema is never used half migrated
+// sql.Open does not connect, so the handle is pinged to report whether the file is usable
+// Pinging creates missing files, so it is skipped if the file does not exist yet
+func New(filepath string, migrate bool) (*sql.DB, error) {
 	db, err := sql.Open("sqlite3", filepath)
 	if err != nil {
-		log.Fatalln("Cannot connect to DB: ", err)
+		return nil, fmt.Errorf("sqlite.New: open error: %w", err)
+	}
+
+	if migrate {
+		applied, err := Migrate(context.Background(), db)
+		for _, m := range applied {
+			log.Infof("Applied migration %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("sqlite.New: %w", err)
+		}
+	}
+
+	if _, err := os.Stat(filepath); err != nil {
+		log.Warnf("SQLite database file %s not accessible: %v", filepath, err)
+	} else if err := db.Ping(); err != nil {
+		log.Warnf("Cannot connect to DB at %s: %v", filepath, err)
 	} else {
 		log.Infof("Successfully connected to DB at %s", filepath)
 	}
 
-	return db
+	return db, nil
 }
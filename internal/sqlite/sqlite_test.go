@@ -0,0 +1,106 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// existingDB returns the path of a database created outside the migrations with schema
+func existingDB(t *testing.T, schema string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "existing.sqlite")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewMigratesExistingTables(t *testing.T) {
+	// Tables the scraper or an earlier deployment created before schema_migrations existed
+	path := existingDB(t, `
+CREATE TABLE units (duid TEXT NOT NULL PRIMARY KEY, station_name TEXT, region_id TEXT,
+	fuel_source TEXT, technology_type TEXT, max_capacity INTEGER);
+CREATE TABLE interconnectors (interconnector_id TEXT NOT NULL PRIMARY KEY, from_region_id TEXT NOT NULL,
+	to_region_id TEXT NOT NULL, description TEXT NOT NULL DEFAULT '', max_import INTEGER NOT NULL DEFAULT 0,
+	max_export INTEGER NOT NULL DEFAULT 0);
+CREATE TABLE unit_history (id INTEGER PRIMARY KEY AUTOINCREMENT, duid TEXT NOT NULL, action TEXT NOT NULL,
+	changed_by TEXT NOT NULL, changed_at TIMESTAMP NOT NULL, before TEXT, after TEXT);
+CREATE INDEX unit_history_duid ON unit_history (duid, changed_at);
+INSERT INTO units VALUES ('BAYSW1', 'Bayswater', 'NSW1', 'Fossil', 'Combustion', 660);`)
+
+	db, err := New(path, true)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer db.Close()
+
+	migrations, err := Status(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if m.AppliedAt == nil && m.Requires == "" {
+			t.Errorf("migration %04d_%s not applied", m.Version, m.Name)
+		}
+	}
+	var units int
+	if err := db.QueryRow("SELECT COUNT(*) FROM units").Scan(&units); err != nil || units != 1 {
+		t.Errorf("units = %d, %v, want the existing unit kept", units, err)
+	}
+}
+
+func TestNewFailsOnMigrationError(t *testing.T) {
+	// 0006 adds the location columns, which this table already has
+	path := existingDB(t, `CREATE TABLE units (duid TEXT NOT NULL PRIMARY KEY, latitude REAL);`)
+
+	if db, err := New(path, true); err == nil {
+		db.Close()
+		t.Fatal("New returned a database with a failed migration")
+	}
+}
+
+func TestSearchMigrationWithoutFTS5(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(filepath.Join(t.TempDir(), "test.sqlite"), true)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer db.Close()
+	if fts5, err := CompileOption(ctx, db, "ENABLE_FTS5"); err != nil || fts5 {
+		t.Skipf("SQLite built with FTS5 (%v)", err)
+	}
+
+	// A database migrated by a build with FTS5, the triggers write to the missing index
+	if _, err := db.Exec(`
+CREATE TRIGGER units_search_insert AFTER INSERT ON units BEGIN
+	INSERT INTO units_search (rowid, duid) VALUES (new.id, new.duid);
+END;
+INSERT INTO schema_migrations (version, name, applied_at) VALUES (8, 'create_units_search', CURRENT_TIMESTAMP);`); err != nil {
+		t.Fatal(err)
+	}
+
+	ready, err := SearchIndexReady(ctx, db)
+	if err != nil || ready {
+		t.Fatalf("SearchIndexReady = %v, %v, want false", ready, err)
+	}
+	if _, err := db.Exec("INSERT INTO units (duid, station_name, region_id, fuel_source, technology_type, max_capacity) VALUES ('BAYSW1', 'Bayswater', 'NSW1', 'Fossil', 'Combustion', 660)"); err != nil {
+		t.Errorf("insert after SearchIndexReady: %v", err)
+	}
+	migrations, err := Status(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if m.Version == searchMigration && m.AppliedAt != nil {
+			t.Errorf("migration %04d_%s still recorded as applied", m.Version, m.Name)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Package tracing configures OpenTelemetry tracing for the API and provides helpers
+// for starting spans around store queries
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters accepted by Options.Exporter
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Query text modes accepted by Options.QueryText
+const (
+	QueryTextFull     = "full"     // the query as sent
+	QueryTextRedacted = "redacted" // string literals replaced with ?
+	QueryTextNone     = "none"     // no query attribute
+)
+
+const instrumentationName = "NemWebGoApi"
+
+// Options configures the tracer provider
+type Options struct {
+	Exporter     string
+	ServiceName  string
+	SampleRatio  float64
+	OTLPEndpoint string // host:port, empty uses OTEL_EXPORTER_OTLP_* environment variables
+	OTLPInsecure bool
+	QueryText    string
+}
+
+var queryTextMode = QueryTextRedacted
+
+// Init installs the global tracer provider and propagator,
+// the returned function flushes and stops the exporter
+// With the none exporter the global no-op provider is left in place
+func Init(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	queryTextMode = opts.QueryText
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch opts.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		clientOpts := []otlptracehttp.Option{}
+		if opts.OTLPEndpoint != "" {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpoint(opts.OTLPEndpoint))
+		}
+		if opts.OTLPInsecure {
+			clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, clientOpts...)
+	default:
+		return nil, fmt.Errorf("tracing.Init: unknown exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing.Init: exporter error: %w", err)
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(opts.ServiceName)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("tracing.Init: resource error: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the API's tracer from the global provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// StartQuery starts a client span for a store query, attaching the query text
+// according to the configured mode, end the span with EndSpan
+func StartQuery(ctx context.Context, system string, measurement string, query string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemKey.String(system),
+		attribute.String("db.measurement", measurement),
+	}
+	if stmt, ok := queryText(query); ok {
+		attrs = append(attrs, semconv.DBStatementKey.String(stmt))
+	}
+
+	return Tracer().Start(
+		ctx,
+		fmt.Sprintf("%s %s", system, measurement),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// EndSpan records err on the span if set and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// stringLiteral matches double or single quoted strings in Flux and SQL
+var stringLiteral = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+
+func queryText(query string) (string, bool) {
+	switch queryTextMode {
+	case QueryTextFull:
+		return query, true
+	case QueryTextNone:
+		return "", false
+	default:
+		return stringLiteral.ReplaceAllString(query, "?"), true
+	}
+}
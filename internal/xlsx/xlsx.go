@@ -0,0 +1,213 @@
+// Package xlsx reads cell values from the worksheets of Office Open XML spreadsheets,
+// enough for tabular downloads such as AEMO's registration list, without formatting or formulas
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrSheetNotFound is returned when the named worksheet is not in the workbook
+var ErrSheetNotFound = errors.New("xlsx: sheet not found")
+
+// Workbook is an opened spreadsheet
+type Workbook struct {
+	files   map[string]*zip.File
+	sheets  []sheetRef
+	strings []string
+}
+
+type sheetRef struct {
+	name string
+	file string
+}
+
+// Open reads the workbook structure and shared strings from r
+func Open(r io.ReaderAt, size int64) (*Workbook, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("xlsx.Open: %w", err)
+	}
+	wb := &Workbook{files: make(map[string]*zip.File)}
+	for _, f := range archive.File {
+		wb.files[f.Name] = f
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := wb.decode("xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := wb.decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels.Relationships {
+		if strings.HasPrefix(rel.Target, "/") {
+			targets[rel.ID] = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			targets[rel.ID] = path.Join("xl", rel.Target)
+		}
+	}
+	for _, sheet := range workbook.Sheets {
+		wb.sheets = append(wb.sheets, sheetRef{name: sheet.Name, file: targets[sheet.RID]})
+	}
+
+	if _, ok := wb.files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []richText `xml:"si"`
+		}
+		if err := wb.decode("xl/sharedStrings.xml", &sst); err != nil {
+			return nil, err
+		}
+		for _, item := range sst.Items {
+			wb.strings = append(wb.strings, item.String())
+		}
+	}
+	return wb, nil
+}
+
+// Sheets returns the names of the worksheets in workbook order
+func (wb *Workbook) Sheets() []string {
+	names := make([]string, 0, len(wb.sheets))
+	for _, sheet := range wb.sheets {
+		names = append(names, sheet.name)
+	}
+	return names
+}
+
+// Rows returns the cell values of the named worksheet, row by row from the first row,
+// empty rows and cells are returned as empty so positions match the spreadsheet
+func (wb *Workbook) Rows(name string) ([][]string, error) {
+	file := ""
+	for _, sheet := range wb.sheets {
+		if sheet.name == name {
+			file = sheet.file
+		}
+	}
+	if file == "" {
+		return nil, fmt.Errorf("%w: %s", ErrSheetNotFound, name)
+	}
+
+	var worksheet struct {
+		Rows []struct {
+			Index int `xml:"r,attr"`
+			Cells []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Value  string   `xml:"v"`
+				Inline richText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := wb.decode(file, &worksheet); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(worksheet.Rows))
+	for i, row := range worksheet.Rows {
+		index := row.Index
+		if index == 0 {
+			index = i + 1
+		}
+		for len(rows) < index-1 {
+			rows = append(rows, []string{})
+		}
+
+		values := make([]string, 0, len(row.Cells))
+		for j, cell := range row.Cells {
+			column := columnIndex(cell.Ref)
+			if column < 0 {
+				column = j
+			}
+			for len(values) < column {
+				values = append(values, "")
+			}
+
+			var value string
+			switch cell.Type {
+			case "s":
+				var n int
+				if _, err := fmt.Sscan(cell.Value, &n); err != nil || n < 0 || n >= len(wb.strings) {
+					return nil, fmt.Errorf("xlsx.Rows: %s!%s: invalid shared string %q", name, cell.Ref, cell.Value)
+				}
+				value = wb.strings[n]
+			case "inlineStr":
+				value = cell.Inline.String()
+			default:
+				value = cell.Value
+			}
+			values = append(values, value)
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+func (wb *Workbook) decode(name string, v interface{}) error {
+	f, ok := wb.files[name]
+	if !ok {
+		return fmt.Errorf("xlsx: %s missing from workbook", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("xlsx: %s: %w", name, err)
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("xlsx: %s: %w", name, err)
+	}
+	return nil
+}
+
+// richText is a string that may be split into formatted runs
+type richText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t richText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	b.WriteString(t.Text)
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+// columnIndex returns the zero based column of a cell reference such as "AB12", -1 if there is none
+func columnIndex(ref string) int {
+	column := 0
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+		n++
+	}
+	if n == 0 {
+		return -1
+	}
+	return column - 1
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
-	"NemWebGoApi/api"
+	"os"
+
+	"NemWebGoApi/internal/cli"
 )
 
 func main() {
-	api.Init(false)
-	api.Run(false)
+	os.Exit(cli.Run(os.Args[1:]))
 }